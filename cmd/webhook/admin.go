@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mutating-webhook/internal/auth"
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/kube"
+	"mutating-webhook/internal/logging"
+)
+
+// newAdminAuth returns the Authenticator and Authorizer of the admin server for the configured
+// mode. Static tokens are allowed everything, which is meant for running without a cluster.
+func newAdminAuth(cfg *config.Config) (auth.Authenticator, auth.Authorizer, error) {
+	if cfg.AdminAuth == config.AdminAuthTokenReview {
+		client, err := kube.NewClientset()
+		if err != nil {
+			return nil, nil, err
+		}
+		return auth.NewTokenReview(client, cfg.AdminAudiences), auth.NewSubjectAccessReview(client), nil
+	}
+
+	static := auth.NewStatic()
+	static.Add(cfg.AdminToken, auth.User{Name: "admin"})
+	if cfg.AdminTokenFile != "" {
+		if err := static.ReadTokenFile(cfg.AdminTokenFile); err != nil {
+			return nil, nil, fmt.Errorf("reading admin token file: %w", err)
+		}
+	}
+	if static.Len() == 0 {
+		slog.Warn("No admin tokens are configured, the admin API refuses every request")
+	}
+	slog.Warn("Admin API uses static tokens, which are allowed every admin request; use tokenreview outside of testing", "tokens", static.Len())
+	return static, auth.AllowAll(), nil
+}
+
+// adminAttributes returns the access to the virtual resources in auth.Group a request of the admin
+// API needs. Reading is get, changing is update. It returns false for paths that are not part of
+// the admin API.
+func adminAttributes(r *http.Request) (auth.Attributes, bool) {
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case "/api/v1/admin":
+		if query.Has("admin-no-mutate") {
+			return auth.Attributes{Verb: "update", Resource: "bypass"}, true
+		}
+		return auth.Attributes{Verb: "get", Resource: "bypass"}, true
+	case "/api/v1/admin/loglevel":
+		if query.Has("level") {
+			return auth.Attributes{Verb: "update", Resource: "loglevel"}, true
+		}
+		return auth.Attributes{Verb: "get", Resource: "loglevel"}, true
+	case "/api/v1/admin/config":
+		return auth.Attributes{Verb: "get", Resource: "config"}, true
+	case "/api/v1/admin/config/reload":
+		return auth.Attributes{Verb: "create", Resource: "config", Subresource: "reload"}, true
+	case "/api/v1/report/drift":
+		return auth.Attributes{Verb: "get", Resource: "reports", Name: "drift"}, true
+	}
+	return auth.Attributes{}, false
+}
+
+func startAdminServer(cfg *config.Config, tlsConfig *tls.Config, svc services) *http.Server {
+	adminServer := &http.Server{
+		Addr:         cfg.AdminIP + ":" + strconv.Itoa(cfg.AdminPort),
+		Handler:      adminServe(svc),
+		ReadTimeout:  cfg.WebServerReadTimeout,
+		WriteTimeout: cfg.WebServerWriteTimeout,
+		IdleTimeout:  cfg.WebServerIdleTimeout,
+		TLSConfig:    tlsConfig,
+	}
+
+	slog.Info("Starting admin server", "ip", cfg.AdminIP, "port", cfg.AdminPort, "auth", cfg.AdminAuth)
+	go func() {
+		if err := adminServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("Admin server failed", "error", err)
+		}
+	}()
+	return adminServer
+}
+
+// adminServe serves the admin and diagnostic endpoints. Everything below /api/ requires a token
+// accepted by the authenticator of svc, and the admin API requires its authorizer to allow the
+// access returned by adminAttributes.
+func adminServe(svc services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httpAccessLog(r)
+		strictTransport(w)
+
+		method := http.MethodGet
+		if r.URL.Path == "/api/v1/admin/config/reload" {
+			method = http.MethodPost
+		}
+		if r.Method != method {
+			msg := fmt.Sprintf("incorrect method: got request type %s, expected request type %s", r.Method, method)
+			slog.Debug(msg)
+			tmpltError(w, http.StatusMethodNotAllowed, msg)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") && !adminAuthorized(w, r, svc) {
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/admin":
+			tmpltAdminToggle(w, r.URL.Query())
+		case "/api/v1/admin/loglevel":
+			tmpltLogLevel(w, r.URL.Query())
+		case "/api/v1/admin/config":
+			tmpltConfig(w, cfg.Load())
+		case "/api/v1/admin/config/reload":
+			err := cfg.Reload()
+			configReloaded(err)
+			tmpltConfigReload(w, err)
+		case "/api/v1/report/drift":
+			tmpltDriftReport(w, svc.drift)
+		case "/healthcheck":
+			tmpltHealthCheck(w)
+		case "/":
+			tmpltWebRoot(w)
+		default:
+			msg := fmt.Sprintf("Unable to locate requested path: '%s'", r.URL.Path)
+			slog.Debug(msg)
+			tmpltError(w, http.StatusNotFound, msg)
+		}
+	}
+}
+
+// adminAuthorized authenticates and authorizes a request below /api/, and writes the error response
+// when it may not proceed.
+func adminAuthorized(w http.ResponseWriter, r *http.Request, svc services) bool {
+	user, err := svc.authenticator.Authenticate(r.Context(), auth.Token(r))
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		slog.Debug("Admin request not authenticated", "path", r.URL.Path, "remote", r.RemoteAddr)
+		tmpltError(w, http.StatusUnauthorized, auth.ErrUnauthenticated.Error())
+		return false
+	case err != nil:
+		slog.Error("Unable to authenticate admin request", "path", r.URL.Path, "remote", r.RemoteAddr, "error", err)
+		tmpltError(w, http.StatusServiceUnavailable, "unable to authenticate the request")
+		return false
+	}
+
+	attrs, ok := adminAttributes(r)
+	if !ok {
+		// unknown paths are answered with not found
+		return true
+	}
+	err = svc.authorizer.Authorize(r.Context(), user, attrs)
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		slog.Info("Admin request forbidden", "path", r.URL.Path, "user", user.Name, "access", attrs.String())
+		tmpltError(w, http.StatusForbidden, fmt.Sprintf("user %q is %v", user.Name, err))
+		return false
+	case err != nil:
+		slog.Error("Unable to authorize admin request", "path", r.URL.Path, "user", user.Name, "error", err)
+		tmpltError(w, http.StatusServiceUnavailable, "unable to authorize the request")
+		return false
+	}
+
+	slog.Info("Admin request", "path", r.URL.Path, "user", user.Name, "access", attrs.String())
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mutating-webhook/internal/backfill"
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/kube"
+	"mutating-webhook/internal/logging"
+)
+
+// runBackfill labels the pods and workloads that existed before the webhook was deployed and
+// prints a JSON summary report. It takes the same flags and environment as the webhook, for
+// example: webhook backfill -DryRun=true -BackfillSelector=app=web
+func runBackfill() {
+	cfg = config.Init()
+
+	client, err := kube.NewClientset()
+	if err != nil {
+		logging.Fatal("Unable to create Kubernetes client", "error", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := backfill.Run(ctx, client, cfg.Load(), backfill.OptionsFromConfig(cfg.Load()))
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	}
+	if err != nil {
+		logging.Fatal("Backfill failed", "error", err)
+	}
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/logging"
+)
+
+// runConfig runs the config subcommands. validate checks configuration files without starting the
+// webhook and prints every problem found, exiting non-zero when there are any, for use in CI:
+//
+//	webhook config validate --config config.yaml
+func runConfig() {
+	if len(os.Args) < 2 || os.Args[1] != "validate" {
+		logging.Fatal("Unknown config subcommand, expected: webhook config validate --config file.yaml")
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	file := fs.String("config", "/etc/webhook/config.yaml", "configuration file to validate, further files may follow as arguments")
+	fs.Parse(os.Args[2:]) //nolint:errcheck
+
+	if !validateConfigFiles(os.Stdout, append([]string{*file}, fs.Args()...)) {
+		os.Exit(1)
+	}
+}
+
+// validateConfigFiles writes the problems found in each file to w and reports whether every file
+// is valid.
+func validateConfigFiles(w io.Writer, files []string) bool {
+	valid := true
+	for _, file := range files {
+		problems := config.ValidateFile(file)
+		for _, problem := range problems {
+			fmt.Fprintf(w, "%s: %v\n", file, problem)
+		}
+		if len(problems) > 0 {
+			valid = false
+			continue
+		}
+		fmt.Fprintf(w, "%s: valid\n", file)
+	}
+	return valid
+}
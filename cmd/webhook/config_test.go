@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yaml")
+	data := "log-level: \"500\"\nlabel-prefix: Not_A_Domain\nwebserver-port: 70000\ncustom-labels:\n  team: \"has spaces\"\n"
+	if err := os.WriteFile(invalid, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if validateConfigFiles(&out, []string{"../../config.yaml", invalid}) {
+		t.Errorf("validateConfigFiles() returned true for an invalid file")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if lines[0] != "../../config.yaml: valid" {
+		t.Errorf("validateConfigFiles() returned incorrect value for a valid file, got %q", lines[0])
+	}
+	for _, key := range []string{"log-level", "label-prefix", "webserver-port", "custom-labels.team"} {
+		if !strings.Contains(out.String(), invalid+": "+key+" ") {
+			t.Errorf("validateConfigFiles() did not report %s, got:\n%s", key, out.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"mutating-webhook/internal/backfill"
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/kube"
+	"mutating-webhook/internal/watcher"
+)
+
+// controllerLease is the Lease electing the replica that runs the background controllers.
+const controllerLease = "custom-labels-webhook-controller"
+
+// startControllers starts the periodic backfill and the namespace watcher, when enabled, on the
+// replica elected through controllerLease. They stop when ctx is cancelled.
+func startControllers(ctx context.Context, svc services) {
+	startup := cfg.Load()
+	backfillEnabled := startup.BackfillInterval > 0
+	watcherEnabled := startup.AppIDChangePolicy != config.AppIDChangeIgnore
+	if !backfillEnabled && !watcherEnabled {
+		return
+	}
+
+	client, err := kube.NewClientset()
+	if err != nil {
+		slog.Warn("Background controllers are disabled", "error", err)
+		return
+	}
+
+	go func() {
+		err := kube.RunLeaderElected(ctx, client, startup.NameSpace, controllerLease, func(ctx context.Context) {
+			if backfillEnabled {
+				go backfill.RunPeriodically(ctx, client, cfg)
+			}
+			if watcherEnabled {
+				go watcher.New(client, cfg, svc.recorder).Run(ctx)
+			}
+			<-ctx.Done()
+		})
+		if err != nil {
+			slog.Error("Background controllers are disabled", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	admission "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/logging"
+	"mutating-webhook/internal/operations"
+)
+
+// evaluation is printed by the evaluate subcommand.
+type evaluation struct {
+	Route  string                    `json:"route"`
+	Review admission.AdmissionReview `json:"review"`
+	Patch  json.RawMessage           `json:"patch,omitempty"`
+	Object json.RawMessage           `json:"object,omitempty"`
+}
+
+// runEvaluate runs an AdmissionReview read from a file through the hook chain of a route, without
+// a cluster or TLS server, and prints the response, the decoded JSON patch and the object with the
+// patch applied. Namespaces are served from a fixture file instead of the API server. It takes the
+// same configuration flags and environment as the webhook, for example:
+//
+//	webhook evaluate -f mock-payloads/pods/pod-create-01.json --namespace-fixture ns.yaml -DryRun=true
+func runEvaluate() {
+	if err := evaluateCommand(os.Args[1:], os.LookupEnv, os.Stdout); err != nil {
+		logging.Fatal("Unable to evaluate AdmissionReview", "error", err)
+	}
+}
+
+// evaluateCommand runs the evaluate subcommand with args, reading the configuration with Load
+// from env and the host file system, and writes the evaluation to w. Unlike the webhook it never
+// generates certificates or exits, so every problem is returned.
+func evaluateCommand(args []string, env func(string) (string, bool), w io.Writer) error {
+	flags := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	file := flags.String("f", "", "AdmissionReview JSON file to evaluate, - for stdin")
+	fixture := flags.String("namespace-fixture", "", "YAML or JSON file with the Namespace objects the request may look up")
+	route := flags.String("route", "/api/v1/mutate/pod", "admission route whose hook chain evaluates the review")
+	output := flags.String("o", "yaml", "output format, yaml or json")
+
+	own, configArgs := splitArgs(flags, args)
+	if err := flags.Parse(own); err != nil {
+		return err
+	}
+	c, warnings, err := config.Load(configArgs, env, config.HostFS)
+	if err != nil {
+		return err
+	}
+	level, _ := logging.ParseLevel(c.LogLevel)
+	if err := logging.Setup(os.Stderr, c.LogFormat, level); err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		slog.Warn("Configuration warning", "warning", warning)
+	}
+
+	if *file == "" {
+		return errors.New("an AdmissionReview file is required, use -f")
+	}
+	if *output != "yaml" && *output != "json" {
+		return fmt.Errorf("unknown output format %q, use yaml or json", *output)
+	}
+
+	routes := admissionRoutes(services{recorder: events.Nop()})
+	hook, ok := routes[*route]
+	if !ok {
+		known := make([]string, 0, len(routes))
+		for path := range routes {
+			known = append(known, path)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown admission route %q, use one of %s", *route, strings.Join(known, ", "))
+	}
+
+	var namespaces []*core.Namespace
+	if *fixture != "" {
+		if namespaces, err = loadNamespaceFixture(*fixture); err != nil {
+			return fmt.Errorf("loading namespace fixture %s: %w", *fixture, err)
+		}
+	}
+	operations.SetNamespaceSource(operations.FixtureNamespaceSource(namespaces...))
+
+	body, err := readInput(*file)
+	if err != nil {
+		return fmt.Errorf("reading AdmissionReview %s: %w", *file, err)
+	}
+
+	result, err := evaluate(context.Background(), newAdmissionHandler(config.NewStore(&c, configArgs)), *route, hook, body)
+	if err != nil {
+		return fmt.Errorf("evaluating %s: %w", *file, err)
+	}
+
+	var out []byte
+	if *output == "json" {
+		out, err = json.MarshalIndent(result, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(result)
+	}
+	if err != nil {
+		return fmt.Errorf("writing evaluation: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// splitArgs separates the flags defined in flags from the configuration flags, which are handed to
+// config.Load. Evaluate takes no positional arguments, so a value following a flag belongs to it.
+func splitArgs(flags *flag.FlagSet, args []string) (own, rest []string) {
+	toOwn := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			toOwn = flags.Lookup(name) != nil
+		}
+		if toOwn {
+			own = append(own, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return own, rest
+}
+
+// evaluate decodes the review like the webhook server does and runs it through the hook.
+func evaluate(ctx context.Context, h *admissionHandler, route string, hook operations.Hook, body []byte) (*evaluation, error) {
+	var review admission.AdmissionReview
+	if _, _, err := h.decoder.Decode(body, nil, &review); err != nil {
+		return nil, fmt.Errorf("could not deserialize request: %w", err)
+	}
+	if review.Request == nil {
+		return nil, errors.New("malformed admission review: request is nil")
+	}
+
+	logger := slog.Default().With("uid", review.Request.UID, "namespace", review.Request.Namespace)
+	result := &evaluation{
+		Route:  route,
+		Review: h.respond(logging.NewContext(ctx, logger), hook, &review),
+	}
+	if result.Review.Response == nil || !result.Review.Response.Allowed {
+		return result, nil
+	}
+
+	// show the object as the API server would persist it, which also catches patches with bad paths
+	var ops []operations.PatchOperation
+	if patch := result.Review.Response.Patch; len(patch) > 0 {
+		result.Patch = patch
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("could not decode JSON patch: %w", err)
+		}
+	}
+	kind := review.Request.Kind
+	object, err := operations.ApplyPatch(schema.GroupVersionKind{Group: kind.Group, Version: kind.Version, Kind: kind.Kind}, review.Request.Object.Raw, ops)
+	if err != nil {
+		return nil, err
+	}
+	result.Object = object
+	return result, nil
+}
+
+// loadNamespaceFixture reads Namespace objects from a YAML or JSON file holding one or more
+// documents.
+func loadNamespaceFixture(path string) ([]*core.Namespace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []*core.Namespace
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		ns := &core.Namespace{}
+		if err := decoder.Decode(ns); err != nil {
+			if errors.Is(err, io.EOF) {
+				return namespaces, nil
+			}
+			return nil, err
+		}
+		if ns.Name == "" {
+			continue
+		}
+		if ns.Kind != "" && ns.Kind != "Namespace" {
+			return nil, fmt.Errorf("unexpected kind %q in namespace fixture", ns.Kind)
+		}
+		namespaces = append(namespaces, ns)
+	}
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
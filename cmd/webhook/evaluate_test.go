@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/operations"
+)
+
+func TestEvaluate(t *testing.T) {
+	namespaces, err := loadNamespaceFixture("testdata/namespaces.yaml")
+	if err != nil {
+		t.Fatalf("loadNamespaceFixture() returned an error: %v", err)
+	}
+	if len(namespaces) != 3 {
+		t.Fatalf("loadNamespaceFixture() returned %d namespaces, wanted 3", len(namespaces))
+	}
+	operations.SetNamespaceSource(operations.FixtureNamespaceSource(namespaces...))
+
+	body, err := os.ReadFile("../../mock-payloads/pods/pod-create-01.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{LabelPrefix: "managed-by", EnableLabeling: true, FailurePolicy: config.FailurePolicyIgnore}
+	cfg.CompileExclusions()
+	route := "/api/v1/mutate/pod"
+	hook := admissionRoutes(services{recorder: events.Nop()})[route]
+
+	result, err := evaluate(context.Background(), newAdmissionHandler(config.NewStore(&cfg, nil)), route, hook, body)
+	if err != nil {
+		t.Fatalf("evaluate() returned an error: %v", err)
+	}
+	if !result.Review.Response.Allowed {
+		t.Errorf("evaluate() returned incorrect value, got allowed %v, wanted true", result.Review.Response.Allowed)
+	}
+
+	var patch []operations.PatchOperation
+	if err := json.Unmarshal(result.Patch, &patch); err != nil {
+		t.Fatalf("evaluate() returned an invalid patch: %v", err)
+	}
+	if len(patch) != 1 || patch[0].Path != "/metadata/labels/managed-by~1appid" || patch[0].Value != "app-123" {
+		t.Errorf("evaluate() returned incorrect patch, got %+v", patch)
+	}
+
+	var pod core.Pod
+	if err := json.Unmarshal(result.Object, &pod); err != nil {
+		t.Fatalf("evaluate() returned an invalid object: %v", err)
+	}
+	if got := pod.Labels["managed-by/appid"]; got != "app-123" {
+		t.Errorf("evaluate() returned incorrect object label, got %q, wanted %q", got, "app-123")
+	}
+}
+
+func TestEvaluateCommand(t *testing.T) {
+	env := map[string]string{"CONFIG_FILE": "testdata/missing.yaml", "LABEL_PREFIX": "example.com"}
+	lookup := func(key string) (string, bool) { v, ok := env[key]; return v, ok }
+
+	var out bytes.Buffer
+	args := []string{"-f", "../../mock-payloads/pods/pod-create-01.json", "-DryRun", "--namespace-fixture", "testdata/namespaces.yaml", "-o", "json"}
+	if err := evaluateCommand(args, lookup, &out); err != nil {
+		t.Fatalf("evaluateCommand() returned an error: %v", err)
+	}
+	var result evaluation
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("evaluateCommand() wrote invalid JSON: %v", err)
+	}
+	// dry run allows the request without patching it
+	if !result.Review.Response.Allowed || len(result.Patch) != 0 {
+		t.Errorf("evaluateCommand() returned incorrect value, got allowed %v with patch %s, wanted allowed without patch", result.Review.Response.Allowed, result.Patch)
+	}
+
+	for _, args := range [][]string{
+		{"-DryRun"},
+		{"-f", "x.json", "-LabelPrefix=Not Valid"},
+		{"-f", "x.json", "--route", "/api/v1/unknown"},
+	} {
+		if err := evaluateCommand(args, lookup, io.Discard); err == nil {
+			t.Errorf("evaluateCommand(%v) returned no error", args)
+		}
+	}
+}
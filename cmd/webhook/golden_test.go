@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/operations"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// payloadRoutes lists the admission routes every payload directory in mock-payloads is sent to.
+var payloadRoutes = map[string][]string{
+	"pods":        {"/api/v1/admit/pod", "/api/v1/mutate/pod"},
+	"deployments": {"/api/v1/admit/deployment"},
+}
+
+// golden is the recorded outcome of one payload on one route. The JSON patch is repeated in
+// decoded form, together with the object it produces, so patch changes are readable in review.
+type golden struct {
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+	Patch    json.RawMessage `json:"patch,omitempty"`
+	Object   json.RawMessage `json:"object,omitempty"`
+}
+
+// goldenScenarios are requests outside the happy path, each sent to one route with the given
+// configuration flags on top of testdata/config.yaml.
+var goldenScenarios = []struct {
+	name    string
+	route   string
+	payload string
+	args    []string
+}{
+	{"excluded-namespace", "/api/v1/mutate/pod", "testdata/requests/excluded-namespace.json", nil},
+	{"missing-appid", "/api/v1/mutate/pod", "testdata/requests/missing-appid.json", nil},
+	{"fail-open", "/api/v1/mutate/pod", "testdata/requests/unknown-namespace.json", nil},
+	{"fail-closed", "/api/v1/mutate/pod", "testdata/requests/unknown-namespace.json", []string{"-FailurePolicy=Fail"}},
+	{"dry-run", "/api/v1/mutate/pod", "../../mock-payloads/pods/pod-create-01.json", []string{"-DryRun=true"}},
+	{"malformed-review", "/api/v1/mutate/pod", "testdata/requests/malformed-review.json", nil},
+}
+
+// TestGolden feeds every file in mock-payloads, and every scenario in goldenScenarios, through
+// ahServe and compares the response with the golden file in testdata/golden. Run with -update to
+// rewrite the golden files after an intended behaviour change, and review the diff.
+func TestGolden(t *testing.T) {
+	namespaces, err := loadNamespaceFixture("testdata/namespaces.yaml")
+	if err != nil {
+		t.Fatalf("loadNamespaceFixture() returned an error: %v", err)
+	}
+	objects := make([]runtime.Object, len(namespaces))
+	for i, ns := range namespaces {
+		objects[i] = ns
+	}
+	operations.SetNamespaceSource(operations.ClientNamespaceSource(fake.NewSimpleClientset(objects...)))
+	routes := admissionRoutes(services{recorder: events.Nop()})
+
+	h := newAdmissionHandler(goldenConfig(t, nil))
+	for dir, paths := range payloadRoutes {
+		payloads, err := filepath.Glob(filepath.Join("../../mock-payloads", dir, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payloads) == 0 {
+			t.Fatalf("no payloads found in mock-payloads/%s", dir)
+		}
+
+		for _, path := range paths {
+			handler := h.ahServe(routes[path])
+			for _, payload := range payloads {
+				name := strings.ReplaceAll(strings.TrimPrefix(path, "/api/v1/"), "/", "-") + "/" + filepath.Base(payload)
+				t.Run(name, func(t *testing.T) {
+					checkGolden(t, name, handler, path, payload)
+				})
+			}
+		}
+	}
+
+	for _, sc := range goldenScenarios {
+		handler := newAdmissionHandler(goldenConfig(t, sc.args)).ahServe(routes[sc.route])
+		name := "scenarios/" + sc.name + ".json"
+		t.Run(name, func(t *testing.T) {
+			checkGolden(t, name, handler, sc.route, sc.payload)
+		})
+	}
+}
+
+// goldenConfig loads testdata/config.yaml with the configuration flags args, the same way the
+// webhook loads its configuration, and ignores the environment of the test.
+func goldenConfig(t *testing.T, args []string) *config.Store {
+	t.Helper()
+	env := func(key string) (string, bool) {
+		if key == "CONFIG_FILE" {
+			return "testdata/config.yaml", true
+		}
+		return "", false
+	}
+	cfg, _, err := config.Load(args, env, config.HostFS)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	return config.NewStore(&cfg, args)
+}
+
+// checkGolden sends the payload to the handler and compares the outcome with the golden file name.
+func checkGolden(t *testing.T, name string, handler http.HandlerFunc, path, payload string) {
+	t.Helper()
+	body, err := os.ReadFile(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	result := golden{Status: rec.Code, Response: rec.Body.Bytes()}
+	var review admission.AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &review); err == nil && review.Response != nil && len(review.Response.Patch) > 0 {
+		result.Patch = review.Response.Patch
+		result.Object = applyResponsePatch(t, body, review.Response.Patch)
+	}
+
+	got, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		t.Fatalf("response is not valid JSON: %v\n%s", err, rec.Body.String())
+	}
+	got = append(got, '\n')
+
+	file := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response does not match %s, run with -update and review the diff\ngot:\n%s\nwanted:\n%s", file, got, want)
+	}
+}
+
+// applyResponsePatch applies the patch of a response to the object of the request it answers and
+// fails the test when the patch does not apply or the result no longer decodes as the original kind.
+func applyResponsePatch(t *testing.T, request, patch []byte) []byte {
+	t.Helper()
+
+	var review admission.AdmissionReview
+	if err := json.Unmarshal(request, &review); err != nil || review.Request == nil {
+		t.Fatalf("unable to decode request: %v", err)
+	}
+	var ops []operations.PatchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		t.Fatalf("unable to decode patch: %v", err)
+	}
+
+	kind := review.Request.Kind
+	object, err := operations.ApplyPatch(schema.GroupVersionKind{Group: kind.Group, Version: kind.Version, Kind: kind.Kind}, review.Request.Object.Raw, ops)
+	if err != nil {
+		t.Errorf("ApplyPatch() returned an error: %v", err)
+		return nil
+	}
+
+	// compact so the golden file is indented consistently
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, object); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
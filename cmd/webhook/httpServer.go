@@ -1,19 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"crypto/tls"
 	"encoding/json"
 
 	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/logging"
 	"mutating-webhook/internal/metrics"
 	"mutating-webhook/internal/operations"
 
@@ -26,89 +30,126 @@ import (
 const InvalidMethod string = "Invalid http method."
 
 func httpAccessLog(req *http.Request) {
-	log.Printf("[TRACE] %s - %s - %s\n", req.Method, req.RemoteAddr, req.RequestURI)
-}
-
-func crossSiteOrigin(w http.ResponseWriter) {
-	w.Header().Add("Access-Control-Allow-Origin", "*")
-	w.Header().Add("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Add("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, X-API-Token")
+	logging.Trace(req.Context(), "HTTP request", "method", req.Method, "remote", req.RemoteAddr, "uri", req.RequestURI)
 }
 
 func strictTransport(w http.ResponseWriter) {
 	w.Header().Add("Strict-Transport-Security", "max-age=63072000")
 }
 
-func httpServer(cfg *config.Config) {
-	// Parse and validate certificate
-	serverCertificate, err := tls.X509KeyPair(append([]byte(cfg.CertCert), []byte(cfg.CACert)...), []byte(cfg.CertPrivateKey))
-	if err != nil {
-		log.Fatalf("[ERROR] Failed to load server certificate: %v", err)
-	}
-
-	// Extract certificate expiry for metrics
-	setCertificateExpiryMetrics(cfg.CertCert)
+// httpServer starts the webhook server, and the metrics and admin servers when they are enabled,
+// and returns them so they can be shut down.
+func httpServer(store *config.Store, svc services) []*http.Server {
+	cfg := store.Load()
 
-	// Setup webhook server
-	webhookMux := http.NewServeMux()
-	ah := &admissionHandler{
-		decoder: serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer(),
-		config:  cfg,
+	// Parse and validate certificate, and record its expiry for metrics
+	if err := serving.load(cfg); err != nil {
+		logging.Fatal("Failed to load server certificate", "error", err)
 	}
 
-	// Webhook endpoints
-	webhookMux.HandleFunc("/api/v1/admit/pod", ah.ahServe(operations.PodsValidation()))
-	webhookMux.HandleFunc("/api/v1/admit/deployment", ah.ahServe(operations.DeploymentsValidation()))
-	webhookMux.HandleFunc("/api/v1/mutate/pod", ah.ahServe(operations.PodsMutation()))
-	webhookMux.HandleFunc("/healthz", healthzHandler())
-	webhookMux.HandleFunc("/readyz", readyzHandler())
-	webhookMux.HandleFunc("/", webServe())
-
 	webhookServer := &http.Server{
 		Addr:         cfg.WebServerIP + ":" + strconv.FormatInt(int64(cfg.WebServerPort), 10),
-		Handler:      webhookMux,
-		ReadTimeout:  time.Duration(cfg.WebServerReadTimeout) * time.Second,
-		WriteTimeout: time.Duration(cfg.WebServerWriteTimeout) * time.Second,
-		IdleTimeout:  time.Duration(cfg.WebServerIdleTimeout) * time.Second,
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-			},
-			Certificates: []tls.Certificate{
-				serverCertificate,
-			},
-			ClientAuth: tls.NoClientCert,
-		},
+		Handler:      admissionMux(store, svc),
+		ReadTimeout:  cfg.WebServerReadTimeout,
+		WriteTimeout: cfg.WebServerWriteTimeout,
+		IdleTimeout:  cfg.WebServerIdleTimeout,
+		TLSConfig:    serverTLSConfig(&serving),
 	}
 
+	servers := []*http.Server{webhookServer}
+
 	// Start metrics server if enabled
 	if cfg.EnableMetrics {
-		go startMetricsServer(cfg.MetricsPort)
+		servers = append(servers, startMetricsServer(cfg.MetricsPort))
+	}
+
+	// Start the admin server on its own listener if enabled
+	if cfg.AdminPort != 0 {
+		servers = append(servers, startAdminServer(cfg, serverTLSConfig(&serving), svc))
 	}
 
-	log.Printf("[INFO] Starting webhook server on %s:%d", cfg.WebServerIP, cfg.WebServerPort)
-	if err := webhookServer.ListenAndServeTLS("", ""); err != nil {
-		metrics.SetWebhookDown()
-		log.Fatalf("[ERROR] Webhook server failed: %s\n", err)
+	slog.Info("Starting webhook server", "ip", cfg.WebServerIP, "port", cfg.WebServerPort)
+	go func() {
+		if err := webhookServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			metrics.SetWebhookDown()
+			logging.Fatal("Webhook server failed", "error", err)
+		}
+	}()
+	return servers
+}
+
+// admissionMux serves the admission endpoints and the health probes of the API server and kubelet,
+// and nothing else.
+func admissionMux(store *config.Store, svc services) *http.ServeMux {
+	mux := http.NewServeMux()
+	ah := newAdmissionHandler(store)
+	for path, hook := range admissionRoutes(svc) {
+		mux.HandleFunc(path, ah.ahServe(hook))
 	}
+	mux.HandleFunc("/healthz", healthzHandler())
+	mux.HandleFunc("/readyz", readyzHandler())
+	return mux
+}
+
+// servingCertificate is the certificate of the webhook and admin servers. It is replaced when a
+// reload reads a rotated certificate or key, without restarting the listeners.
+type servingCertificate struct {
+	current atomic.Pointer[tls.Certificate]
 }
 
-func startMetricsServer(port int) {
+// serving is the certificate every server of the process presents.
+var serving servingCertificate
+
+// load parses the certificate and key of cfg and serves them from now on. When they do not form a
+// key pair the current certificate is kept and the error returned.
+func (s *servingCertificate) load(cfg *config.Config) error {
+	certificate, err := tls.X509KeyPair(append([]byte(cfg.CertCert), []byte(cfg.CACert)...), []byte(cfg.CertPrivateKey))
+	if err != nil {
+		return err
+	}
+	if current := s.current.Load(); current != nil && reflect.DeepEqual(current.Certificate, certificate.Certificate) {
+		return nil
+	}
+	s.current.Store(&certificate)
+	setCertificateExpiryMetrics(cfg.CertCert)
+	return nil
+}
+
+// GetCertificate returns the current certificate for every TLS handshake.
+func (s *servingCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.current.Load(), nil
+}
+
+// serverTLSConfig returns the TLS configuration of the webhook and admin servers.
+func serverTLSConfig(certificate *servingCertificate) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+		GetCertificate: certificate.GetCertificate,
+		ClientAuth:     tls.NoClientCert,
+	}
+}
+
+func startMetricsServer(port int) *http.Server {
 	metricsServer := &http.Server{
 		Addr:    ":" + strconv.Itoa(port),
 		Handler: metrics.Handler(),
 	}
 
-	log.Printf("[INFO] Starting metrics server on port %d", port)
-	if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("[ERROR] Metrics server failed: %v", err)
-	}
+	slog.Info("Starting metrics server", "port", port)
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	return metricsServer
 }
 
 func setCertificateExpiryMetrics(certPEM string) {
@@ -139,47 +180,28 @@ func readyzHandler() http.HandlerFunc {
 	}
 }
 
-func webServe() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		httpAccessLog(r)
-		crossSiteOrigin(w)
-		strictTransport(w)
-
-		switch {
-		case r.Method != http.MethodGet:
-			msg := fmt.Sprintf("incorrect method: got request type %s, expected request type %s", r.Method, http.MethodPost)
-			log.Printf("[DEBUG] %s", msg)
-			tmpltError(w, http.StatusMethodNotAllowed, msg)
-		case r.URL.Path == "/api/v1/admin":
-			tmpltAdminToggle(w, r.URL.Query())
-		case r.URL.Path == "/healthcheck":
-			tmpltHealthCheck(w)
-		case r.URL.Path == "/":
-			tmpltWebRoot(w)
-		default:
-			msg := fmt.Sprintf("Unable to locate requested path: '%s'", r.URL.Path)
-			log.Printf("[DEBUG] %s", msg)
-			tmpltError(w, http.StatusNotFound, msg)
-		}
-	}
-}
-
 type admissionHandler struct {
 	decoder runtime.Decoder
-	config  *config.Config
+	config  *config.Store
+}
+
+func newAdmissionHandler(store *config.Store) *admissionHandler {
+	return &admissionHandler{
+		decoder: serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer(),
+		config:  store,
+	}
 }
 
 func (h *admissionHandler) ahServe(hook operations.Hook) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 		httpAccessLog(r)
-		crossSiteOrigin(w)
 		strictTransport(w)
 
 		w.Header().Set("Content-Type", "application/json")
 		if r.Method != http.MethodPost {
 			msg := fmt.Sprintf("incorrect method: got request type %s, expected request type %s", r.Method, http.MethodPost)
-			log.Printf("[DEBUG] %s", msg)
+			slog.Debug(msg)
 			metrics.RecordError("method_not_allowed", "admission")
 			tmpltError(w, http.StatusMethodNotAllowed, msg)
 			return
@@ -187,7 +209,7 @@ func (h *admissionHandler) ahServe(hook operations.Hook) http.HandlerFunc {
 
 		if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
 			msg := "only content type 'application/json' is supported"
-			log.Printf("[DEBUG] %s", msg)
+			slog.Debug(msg)
 			metrics.RecordError("invalid_content_type", "admission")
 			tmpltError(w, http.StatusBadRequest, msg)
 			return
@@ -196,7 +218,7 @@ func (h *admissionHandler) ahServe(hook operations.Hook) http.HandlerFunc {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			msg := fmt.Sprintf("could not read request body: %v", err)
-			log.Printf("[DEBUG] %s", msg)
+			slog.Debug(msg)
 			metrics.RecordError("body_read_error", "admission")
 			tmpltError(w, http.StatusBadRequest, msg)
 			return
@@ -205,7 +227,7 @@ func (h *admissionHandler) ahServe(hook operations.Hook) http.HandlerFunc {
 		var review admission.AdmissionReview
 		if _, _, err := h.decoder.Decode(body, nil, &review); err != nil {
 			msg := fmt.Sprintf("could not deserialize request: %v", err)
-			log.Printf("[DEBUG] %s", msg)
+			slog.Debug(msg)
 			metrics.RecordError("decode_error", "admission")
 			tmpltError(w, http.StatusBadRequest, msg)
 			return
@@ -213,70 +235,141 @@ func (h *admissionHandler) ahServe(hook operations.Hook) http.HandlerFunc {
 
 		if review.Request == nil {
 			msg := "malformed admission review: request is nil"
-			log.Printf("[DEBUG] %s", msg)
+			slog.Debug(msg)
 			metrics.RecordError("nil_request", "admission")
 			tmpltError(w, http.StatusBadRequest, msg)
 			return
 		}
 
-		// Record admission request metrics
-		namespace := review.Request.Namespace
-		if namespace == "" {
-			namespace = "cluster-scope"
-		}
-		resource := review.Request.Kind.Kind
-		operation := string(review.Request.Operation)
+		// every log line for this request carries the request identity
+		logger := slog.Default().With(
+			"uid", review.Request.UID,
+			"namespace", review.Request.Namespace,
+			"kind", review.Request.Kind.Kind,
+			"operation", review.Request.Operation,
+			"user", review.Request.UserInfo.Username,
+		)
+		ctx := logging.NewContext(r.Context(), logger)
+
+		admissionResponse := h.respond(ctx, hook, &review)
 
-		result, err := hook.Execute(review.Request, h.config)
+		res, err := json.Marshal(admissionResponse)
 		if err != nil {
-			msg := err.Error()
-			log.Printf("[ERROR] Internal Server Error: %s", msg)
-			metrics.RecordError("hook_execution_error", "admission")
-			metrics.RecordAdmissionRequest(operation, resource, namespace, false, time.Since(startTime))
+			msg := fmt.Sprintf("could not marshal response: %v", err)
+			logger.Error(msg)
+			metrics.RecordError("response_marshal_error", "admission")
 			tmpltError(w, http.StatusInternalServerError, msg)
 			return
 		}
 
-		admissionResponse := admission.AdmissionReview{
-			Response: &admission.AdmissionResponse{
-				UID:     review.Request.UID,
-				Allowed: result.Allowed,
-				Result:  &meta.Status{Message: result.Msg},
-			},
+		logger.Debug("Webhook response", "allowed", admissionResponse.Response.Allowed, "duration", time.Since(startTime))
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
+
+// respond runs the hook against the request of the review and builds the AdmissionReview sent back
+// to the API server. It is shared by the HTTP handler and the evaluate subcommand.
+func (h *admissionHandler) respond(ctx context.Context, hook operations.Hook, review *admission.AdmissionReview) admission.AdmissionReview {
+	startTime := time.Now()
+
+	// Record admission request metrics
+	namespace := review.Request.Namespace
+	if namespace == "" {
+		namespace = "cluster-scope"
+	}
+	resource := review.Request.Kind.Kind
+	operation := string(review.Request.Operation)
+
+	admissionResponse := admission.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+	}
+	if admissionResponse.APIVersion == "" {
+		admissionResponse.TypeMeta = meta.TypeMeta{APIVersion: admission.SchemeGroupVersion.String(), Kind: "AdmissionReview"}
+	}
+
+	// the whole request is handled with the configuration current when it arrived
+	cfg := h.config.Load()
+
+	var (
+		appid   string
+		patches int
+	)
+	result, err := hook.Execute(ctx, review.Request, cfg)
+	switch {
+	case err != nil:
+		admissionResponse.Response = h.failureResponse(ctx, cfg, hook, review.Request, err)
+	default:
+		appid = result.AppID
+		admissionResponse.Response = &admission.AdmissionResponse{
+			UID:              review.Request.UID,
+			Allowed:          result.Allowed,
+			Result:           &meta.Status{Message: result.Msg},
+			AuditAnnotations: result.AuditAnnotations,
 		}
 
-		// set the patch operations for mutating admission
-		if len(result.PatchOps) > 0 {
-			patchBytes, err := json.Marshal(result.PatchOps)
+		// set the patch operations for mutating admission, merged to one operation per location
+		ops := new(operations.Patch).Append(result.PatchOps...).Operations()
+		if len(ops) > 0 {
+			if err := operations.ValidatePatch(ops); err != nil {
+				admissionResponse.Response = h.failureResponse(ctx, cfg, hook, review.Request, fmt.Errorf("invalid JSON patch: %w", err))
+				break
+			}
+			patchBytes, err := json.Marshal(ops)
 			if err != nil {
-				msg := fmt.Sprintf("could not marshal JSON patch: %v", err)
-				log.Printf("[ERROR] %s", msg)
-				metrics.RecordError("patch_marshal_error", "admission")
-				tmpltError(w, http.StatusInternalServerError, msg)
-				return
+				admissionResponse.Response = h.failureResponse(ctx, cfg, hook, review.Request, fmt.Errorf("could not marshal JSON patch: %w", err))
+				break
 			}
+			patchType := admission.PatchTypeJSONPatch
 			admissionResponse.Response.Patch = patchBytes
-			
+			admissionResponse.Response.PatchType = &patchType
+			patches = len(ops)
+
 			// Record mutation metrics
 			metrics.RecordMutation(namespace, "labels", true)
-			metrics.RecordLabelsApplied(namespace, resource, len(result.PatchOps))
+			metrics.RecordLabelsApplied(namespace, resource, len(ops))
 		}
+	}
 
-		res, err := json.Marshal(admissionResponse)
-		if err != nil {
-			msg := fmt.Sprintf("could not marshal response: %v", err)
-			log.Printf("[ERROR] %s", msg)
-			metrics.RecordError("response_marshal_error", "admission")
-			tmpltError(w, http.StatusInternalServerError, msg)
-			return
-		}
+	// Record admission request
+	metrics.RecordAdmissionRequest(operation, resource, namespace, admissionResponse.Response.Allowed, time.Since(startTime))
 
-		// Record successful admission request
-		metrics.RecordAdmissionRequest(operation, resource, namespace, result.Allowed, time.Since(startTime))
+	logging.FromContext(ctx).Debug("Admission response",
+		"allowed", admissionResponse.Response.Allowed,
+		"appid", appid,
+		"patches", patches,
+	)
+	return admissionResponse
+}
 
-		log.Printf("[DEBUG] Webhook [%s] - Resource: %s - Namespace: %s - Allowed: %t - Patches: %d", 
-			review.Request.Operation, resource, namespace, result.Allowed, len(result.PatchOps))
-		w.WriteHeader(http.StatusOK)
-		w.Write(res)
+// failureResponse builds the response for a request whose hook could not complete. Depending on the
+// failure policy of the hook the request is either allowed with a warning or denied with an
+// explanatory status, so the API server always receives a well formed AdmissionReview.
+func (h *admissionHandler) failureResponse(ctx context.Context, cfg *config.Config, hook operations.Hook, r *admission.AdmissionRequest, err error) *admission.AdmissionResponse {
+	logger := logging.FromContext(ctx)
+	if cfg.FailsClosed(hook.Name) {
+		msg := fmt.Sprintf("%s hook failed, denying request: %v", hook.Name, err)
+		logger.Error(msg)
+		metrics.RecordError("hook_failed_closed", "admission")
+		return &admission.AdmissionResponse{
+			UID:     r.UID,
+			Allowed: false,
+			Result: &meta.Status{
+				Status:  meta.StatusFailure,
+				Code:    http.StatusInternalServerError,
+				Reason:  meta.StatusReasonInternalError,
+				Message: msg,
+			},
+		}
+	}
+
+	msg := fmt.Sprintf("%s hook failed, allowing request without changes: %v", hook.Name, err)
+	logger.Error(msg)
+	metrics.RecordError("hook_failed_open", "admission")
+	return &admission.AdmissionResponse{
+		UID:      r.UID,
+		Allowed:  true,
+		Result:   &meta.Status{Message: msg},
+		Warnings: []string{msg},
 	}
 }
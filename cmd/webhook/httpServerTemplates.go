@@ -1,16 +1,23 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"strconv"
 
 	"encoding/json"
 	"net/http"
 	"net/url"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/drift"
+	"mutating-webhook/internal/logging"
+	"mutating-webhook/internal/operations"
 )
 
 const cT string = "Content-Type"
 const cTjson string = "application/json"
-const marshalErrorMsg string = "[TRACE] Unable to marshal error message: %v."
+const marshalErrorMsg string = "Unable to marshal error message"
 
 func tmpltError(w http.ResponseWriter, s int, m string) {
 	var (
@@ -29,7 +36,7 @@ func tmpltError(w http.ResponseWriter, s int, m string) {
 
 	output, err = json.MarshalIndent(o, "", "  ")
 	if err != nil {
-		log.Printf(marshalErrorMsg, err)
+		slog.Error(marshalErrorMsg, "error", err)
 	}
 	w.WriteHeader(s)
 	w.Write(output) //nolint:errcheck
@@ -46,7 +53,7 @@ func tmpltHealthCheck(w http.ResponseWriter) {
 
 	output, err := json.MarshalIndent(o, "", "  ")
 	if err != nil {
-		log.Printf(marshalErrorMsg, err)
+		slog.Error(marshalErrorMsg, "error", err)
 	}
 
 	w.Header().Add(cT, cTjson)
@@ -67,17 +74,17 @@ func tmpltWebRoot(w http.ResponseWriter) {
 
 	output, err := json.MarshalIndent(o, "", "  ")
 	if err != nil {
-		log.Printf(marshalErrorMsg, err)
+		slog.Error(marshalErrorMsg, "error", err)
 	}
 	w.Write(output) //nolint:errcheck
 }
 
 func tmpltAdminToggle(w http.ResponseWriter, urlPrams url.Values) {
 	o := struct {
-		Application string `json:"application" yaml:"application"`
-		Description string `json:"description" yaml:"description"`
-		Version     string `json:"version" yaml:"version"`
-		AdminNoMutate bool `json:"admin-no-mutate" yaml:"admin-no-mutate"`
+		Application   string `json:"application" yaml:"application"`
+		Description   string `json:"description" yaml:"description"`
+		Version       string `json:"version" yaml:"version"`
+		AdminNoMutate bool   `json:"admin-no-mutate" yaml:"admin-no-mutate"`
 	}{
 		Application: "AppID Labeling Webhook API",
 		Description: "Mutating Webhook for AppID Label Application",
@@ -85,12 +92,105 @@ func tmpltAdminToggle(w http.ResponseWriter, urlPrams url.Values) {
 	}
 	w.Header().Add(cT, cTjson)
 
-	// Admin toggle functionality removed for simplified webhook
-	o.AdminNoMutate = cfg.AllowAdminNoMutate
+	// the runtime bypass can only be toggled when admin no-mutate is allowed
+	if v := urlPrams.Get("admin-no-mutate"); v != "" {
+		if !cfg.Load().AllowAdminNoMutate {
+			tmpltError(w, http.StatusConflict, "the runtime bypass cannot be toggled, allow-admin-nomutate is disabled")
+			return
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			tmpltError(w, http.StatusBadRequest, fmt.Sprintf("invalid value for admin-no-mutate: '%s'", v))
+			return
+		}
+		operations.SetBypass(enabled)
+		slog.Info("Runtime bypass changed", "enabled", enabled)
+	}
+	o.AdminNoMutate = operations.Bypassed()
+
+	output, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		slog.Error(marshalErrorMsg, "error", err)
+	}
+	w.Write(output) //nolint:errcheck
+}
+
+func tmpltLogLevel(w http.ResponseWriter, urlPrams url.Values) {
+	o := struct {
+		Level string `json:"level" yaml:"level"`
+	}{}
+	w.Header().Add(cT, cTjson)
+
+	if v := urlPrams.Get("level"); v != "" {
+		level, err := logging.ParseLevel(v)
+		if err != nil {
+			tmpltError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logging.SetLevel(level)
+		slog.Info("Log level changed", "level", logging.LevelName(level))
+	}
+	o.Level = logging.LevelName(logging.Level())
+
+	output, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		slog.Error(marshalErrorMsg, "error", err)
+	}
+	w.Write(output) //nolint:errcheck
+}
+
+func tmpltDriftReport(w http.ResponseWriter, reporter *drift.Reporter) {
+	if reporter == nil {
+		tmpltError(w, http.StatusServiceUnavailable, "drift report is not available")
+		return
+	}
+
+	report, err := reporter.Report()
+	if err != nil {
+		tmpltError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Add(cT, cTjson)
+
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		slog.Error(marshalErrorMsg, "error", err)
+	}
+	w.Write(output) //nolint:errcheck
+}
+
+func tmpltConfig(w http.ResponseWriter, c *config.Config) {
+	o := struct {
+		ConfigFile string           `json:"configFile" yaml:"configFile"`
+		Settings   []config.Setting `json:"settings" yaml:"settings"`
+	}{
+		ConfigFile: c.ConfigFile,
+		Settings:   c.Dump(),
+	}
+	w.Header().Add(cT, cTjson)
+
+	output, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		slog.Error(marshalErrorMsg, "error", err)
+	}
+	w.Write(output) //nolint:errcheck
+}
+
+func tmpltConfigReload(w http.ResponseWriter, err error) {
+	if err != nil {
+		tmpltError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	o := struct {
+		Reloaded bool `json:"reloaded" yaml:"reloaded"`
+	}{
+		Reloaded: true,
+	}
+	w.Header().Add(cT, cTjson)
 
 	output, err := json.MarshalIndent(o, "", "  ")
 	if err != nil {
-		log.Printf(marshalErrorMsg, err)
+		slog.Error(marshalErrorMsg, "error", err)
 	}
 	w.Write(output) //nolint:errcheck
 }
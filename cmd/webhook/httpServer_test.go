@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"mutating-webhook/internal/config"
+)
+
+// selfSigned returns a PEM encoded certificate for name and its private key.
+func selfSigned(t *testing.T, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestServingCertificate(t *testing.T) {
+	var s servingCertificate
+	served := func() string {
+		certificate, err := s.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.DNSNames[0]
+	}
+
+	cert, key := selfSigned(t, "before")
+	if err := s.load(&config.Config{CertCert: cert, CertPrivateKey: key}); err != nil {
+		t.Fatalf("load() returned an error: %v", err)
+	}
+	rotated, rotatedKey := selfSigned(t, "after")
+	if err := s.load(&config.Config{CertCert: rotated, CertPrivateKey: rotatedKey}); err != nil {
+		t.Fatalf("load() returned an error: %v", err)
+	}
+	if got := served(); got != "after" {
+		t.Errorf("GetCertificate() returned incorrect value, got %v, wanted %v", got, "after")
+	}
+
+	// a certificate rotated before its key keeps the current certificate
+	if err := s.load(&config.Config{CertCert: cert, CertPrivateKey: rotatedKey}); err == nil {
+		t.Errorf("load() of a mismatched key returned no error")
+	}
+	if got := served(); got != "after" {
+		t.Errorf("GetCertificate() returned incorrect value, got %v, wanted %v", got, "after")
+	}
+}
@@ -2,23 +2,131 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"k8s.io/client-go/informers"
+
+	"mutating-webhook/internal/audit"
+	"mutating-webhook/internal/auth"
 	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/drift"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/kube"
+	"mutating-webhook/internal/logging"
 	"mutating-webhook/internal/metrics"
+	"mutating-webhook/internal/operations"
 )
 
-// global configuration
-var cfg config.Config
+// global configuration, swapped as a whole when the configuration file is reloaded
+var cfg *config.Store
+
+// services holds the long lived components shared by the HTTP handlers.
+type services struct {
+	auditor  *audit.Auditor
+	recorder events.Recorder
+	drift    *drift.Reporter
+
+	// authenticator and authorizer check the requests to the admin server
+	authenticator auth.Authenticator
+	authorizer    auth.Authorizer
+}
+
+// subcommands run instead of the webhook server when named as the first argument.
+var subcommands = map[string]func(){
+	"backfill": runBackfill,
+	"config":   runConfig,
+	"evaluate": runEvaluate,
+}
+
+// configReloaded records and logs the outcome of a configuration reload.
+func configReloaded(err error) {
+	metrics.RecordConfigReload(err == nil)
+	if err != nil {
+		slog.Error("Configuration reload rejected, keeping the last good configuration", "file", cfg.Load().ConfigFile, "error", err)
+		return
+	}
+	slog.Info("Configuration reloaded", "file", cfg.Load().ConfigFile)
+
+	// serve a rotated certificate, keeping the current one when the new files do not match
+	if err := serving.load(cfg.Load()); err != nil {
+		slog.Error("Unable to load the reloaded server certificate, keeping the current one", "error", err)
+	}
+}
 
 func main() {
+	// Run a subcommand instead of the webhook server
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			run()
+			return
+		}
+	}
+
 	// Initialize application configuration
 	cfg = config.Init()
 
+	// settings tagged reload:"false" keep their startup value for the life of the process
+	startup := cfg.Load()
+
+	// Setup the audit trail of admission decisions
+	auditSink, err := audit.NewSink(startup.AuditSink)
+	if err != nil {
+		logging.Fatal("Unable to create audit sink", "sink", startup.AuditSink, "error", err)
+	}
+	// Look namespaces up through a single shared client
+	if client, err := kube.NewClientset(); err == nil {
+		operations.SetNamespaceSource(operations.ClientNamespaceSource(client))
+	}
+
+	svc := services{
+		auditor:  audit.New(auditSink, startup.AuditQueueSize),
+		recorder: events.Nop(),
+	}
+
+	// Setup Kubernetes events for labeling outcomes
+	if startup.EnableEvents {
+		client, err := kube.NewClientset()
+		if err != nil {
+			slog.Warn("Kubernetes events are disabled", "error", err)
+		} else {
+			recorder, stop := events.New(client, startup.EventInterval)
+			defer stop()
+			svc.recorder = recorder
+		}
+	}
+
+	// Run the background controllers on the elected replica
+	ctx, stopControllers := context.WithCancel(context.Background())
+	defer stopControllers()
+	startControllers(ctx, svc)
+
+	// Reload the configuration file when it changes, keeping the last good configuration
+	if startup.ConfigReloadInterval > 0 {
+		go cfg.Watch(ctx, startup.ConfigReloadInterval, configReloaded)
+	}
+
+	// Authenticate the admin server and cache namespaces and pods for its drift report
+	if startup.AdminPort != 0 {
+		svc.authenticator, svc.authorizer, err = newAdminAuth(startup)
+		if err != nil {
+			logging.Fatal("Unable to set up admin server authentication", "auth", startup.AdminAuth, "error", err)
+		}
+
+		client, err := kube.NewClientset()
+		if err != nil {
+			slog.Warn("Drift report is disabled", "error", err)
+		} else {
+			factory := informers.NewSharedInformerFactory(client, 0)
+			svc.drift = drift.NewReporter(factory, cfg)
+			factory.Start(ctx.Done())
+		}
+	}
+
 	// Setup graceful shutdown
 	cancel := make(chan struct{})
 	defer close(cancel)
@@ -27,28 +135,21 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	log.Printf("[INFO] Starting AppID Labeling Webhook v1.0.0")
-	log.Printf("[INFO] Namespace: %s", cfg.NameSpace)
-	log.Printf("[INFO] Service: %s", cfg.ServiceName)
-	log.Printf("[INFO] Organization: %s", cfg.Organization)
-	log.Printf("[INFO] Environment: %s", cfg.Environment)
-	log.Printf("[INFO] Enable Labeling: %t", cfg.EnableLabeling)
-	log.Printf("[INFO] Enable Metrics: %t", cfg.EnableMetrics)
-
-	// Start HTTP server in a goroutine
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[ERROR] HTTP server panic: %v", r)
-				metrics.SetWebhookDown()
-			}
-		}()
-		httpServer(&cfg)
-	}()
+	slog.Info("Starting AppID Labeling Webhook v1.0.0",
+		"namespace", startup.NameSpace,
+		"service", startup.ServiceName,
+		"organization", startup.Organization,
+		"environment", startup.Environment,
+		"enableLabeling", startup.EnableLabeling,
+		"enableMetrics", startup.EnableMetrics,
+	)
+
+	// Start the HTTP servers
+	servers := httpServer(cfg, svc)
 
 	// Wait for shutdown signal
 	sig := <-sigChan
-	log.Printf("[INFO] Received %s signal, initiating graceful shutdown...", sig)
+	slog.Info("Received signal, initiating graceful shutdown...", "signal", sig.String())
 
 	// Set webhook as down in metrics
 	metrics.SetWebhookDown()
@@ -57,14 +158,17 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
-	// Perform graceful shutdown
-	log.Printf("[INFO] Graceful shutdown completed")
+	// Stop accepting requests and wait for the ones in flight, which may still audit decisions
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Unable to shut down server", "addr", server.Addr, "error", err)
+		}
+	}
 
-	// Wait for shutdown context or timeout
-	select {
-	case <-shutdownCtx.Done():
-		log.Printf("[INFO] Shutdown timeout reached")
-	default:
-		log.Printf("[INFO] Clean shutdown completed")
+	// Flush pending audit records
+	if err := svc.auditor.Close(); err != nil {
+		slog.Error("Unable to close audit sink", "error", err)
 	}
+
+	slog.Info("Graceful shutdown completed")
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"mutating-webhook/internal/operations"
+)
+
+// admissionRoutes maps every admission path served by the webhook to its hook, wrapped in the
+// middleware chain for its kind. The webhook server and the evaluate subcommand both serve from
+// this table so they always run the same chain.
+func admissionRoutes(svc services) map[string]operations.Hook {
+	// Middleware shared by every admission route. Mutating routes additionally honor the
+	// labeling toggles and dry run mode.
+	validating := []operations.Middleware{
+		operations.Recover(),
+		operations.Timing(),
+		operations.Audit(svc.auditor),
+		operations.Events(svc.recorder),
+		operations.Deadline(),
+		operations.Exclusion(),
+	}
+	mutating := []operations.Middleware{
+		operations.Recover(),
+		operations.Timing(),
+		operations.Audit(svc.auditor),
+		operations.Events(svc.recorder),
+		operations.Deadline(),
+		operations.Exclusion(),
+		operations.Bypass(),
+		operations.DryRun(),
+	}
+
+	return map[string]operations.Hook{
+		"/api/v1/admit/pod":        operations.PodsValidation().With(validating...),
+		"/api/v1/admit/deployment": operations.DeploymentsValidation().With(validating...),
+		"/api/v1/mutate/pod":       operations.PodsMutation().With(mutating...),
+	}
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"mutating-webhook/internal/metrics"
+)
+
+// ObjectReference identifies the object an admission decision was made for.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// Record is a single admission decision.
+type Record struct {
+	Time         time.Time         `json:"time"`
+	UID          string            `json:"uid"`
+	Hook         string            `json:"hook"`
+	Operation    string            `json:"operation"`
+	Object       ObjectReference   `json:"object"`
+	User         string            `json:"user"`
+	AppID        string            `json:"appid,omitempty"`
+	Source       string            `json:"source,omitempty"`
+	LabelsBefore map[string]string `json:"labelsBefore,omitempty"`
+	LabelsAfter  map[string]string `json:"labelsAfter,omitempty"`
+	Patch        json.RawMessage   `json:"patch,omitempty"`
+	DryRun       bool              `json:"dryRun,omitempty"`
+	Allowed      bool              `json:"allowed"`
+	Message      string            `json:"message,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Sink receives audit records. Sinks are only called from the Auditor's writer goroutine and do
+// not need to be safe for concurrent use.
+type Sink interface {
+	Write(Record) error
+	Close() error
+}
+
+// Auditor delivers records to a sink without blocking the admission path. Records are queued and
+// dropped, with a metric, when the queue is full or the Auditor is closed.
+type Auditor struct {
+	sink    Sink
+	records chan Record
+	done    chan struct{}
+
+	// mu guards closed, so Record never sends on the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts an Auditor writing to sink with a queue of the given size. A nil sink returns a nil
+// Auditor, which discards every record.
+func New(sink Sink, queueSize int) *Auditor {
+	if sink == nil {
+		return nil
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+
+	a := &Auditor{
+		sink:    sink,
+		records: make(chan Record, queueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues the record for delivery. It never blocks, and is safe to call after Close.
+func (a *Auditor) Record(rec Record) {
+	if a == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		metrics.RecordError("audit_record_dropped", "audit")
+		return
+	}
+	select {
+	case a.records <- rec:
+	default:
+		metrics.RecordError("audit_record_dropped", "audit")
+	}
+}
+
+// Close flushes queued records and closes the sink.
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return a.sink.Close()
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+	for rec := range a.records {
+		if err := a.sink.Write(rec); err != nil {
+			slog.Error("Unable to write audit record", "uid", rec.UID, "error", err)
+			metrics.RecordError("audit_write_error", "audit")
+		}
+	}
+}
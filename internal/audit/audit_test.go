@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewSink("file://" + path)
+	if err != nil {
+		t.Fatalf("NewSink() returned an unexpected error: %v", err)
+	}
+
+	auditor := New(sink, 10)
+	auditor.Record(Record{UID: "one", AppID: "app-1", Allowed: true})
+	auditor.Record(Record{UID: "two", Allowed: false})
+	if err := auditor.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %v", err)
+	}
+	// a record after Close, such as one racing the shutdown, is dropped instead of panicking
+	auditor.Record(Record{UID: "late"})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open audit file: %v", err)
+	}
+	defer f.Close()
+
+	var uids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("audit file contains an invalid line %q: %v", scanner.Text(), err)
+		}
+		if rec.Time.IsZero() {
+			t.Errorf("audit record %s was written without a timestamp", rec.UID)
+		}
+		uids = append(uids, rec.UID)
+	}
+	if len(uids) != 2 || uids[0] != "one" || uids[1] != "two" {
+		t.Errorf("audit file contains records %v, wanted [one two]", uids)
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	if sink, err := NewSink(""); sink != nil || err != nil {
+		t.Errorf("NewSink(\"\") returned %v, %v, wanted a nil sink", sink, err)
+	}
+	for _, target := range []string{"ftp://example.com", "file://", "syslog://"} {
+		if _, err := NewSink(target); err == nil {
+			t.Errorf("NewSink(%q) did not return an error", target)
+		}
+	}
+
+	// a nil auditor discards records
+	var auditor *Auditor
+	auditor.Record(Record{UID: "ignored"})
+	if err := auditor.Close(); err != nil {
+		t.Errorf("Close() on a nil auditor returned an error: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// NewSink creates a sink from a target description:
+//
+//	""                       auditing disabled (nil sink)
+//	stdout                   JSON lines on standard output
+//	file:///path/audit.log   JSON lines appended to a file
+//	http://host:port/path    each record POSTed as JSON to a local collector
+//	syslog                   local syslog daemon
+//	syslog://host:port       remote syslog over UDP (syslog+tcp:// for TCP)
+func NewSink(target string) (Sink, error) {
+	switch {
+	case target == "" || target == "none":
+		return nil, nil
+	case target == "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case target == "syslog":
+		return newSyslogSink("", "")
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit sink '%s': %w", target, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return newFileSink(u.Path)
+	case "http", "https":
+		return &httpSink{url: u.String(), client: &http.Client{Timeout: 5 * time.Second}}, nil
+	case "syslog":
+		return newSyslogSink("udp", u.Host)
+	case "syslog+tcp":
+		return newSyslogSink("tcp", u.Host)
+	}
+	return nil, fmt.Errorf("unsupported audit sink '%s', expected stdout, file://, http://, https:// or syslog://", target)
+}
+
+// writerSink writes records as JSON lines.
+type writerSink struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+func newFileSink(path string) (*writerSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file audit sink requires a path")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{w: f, closer: f}, nil
+}
+
+func (s *writerSink) Write(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// httpSink POSTs each record to a collector.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(rec Record) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// syslogSink sends records as JSON messages to syslog.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, addr string) (*syslogSink, error) {
+	if network != "" && addr == "" {
+		return nil, fmt.Errorf("syslog audit sink requires a host and port")
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_AUTH, "appid-webhook")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(rec Record) error {
+	msg, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(strings.TrimSpace(string(msg)))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	authentication "k8s.io/api/authentication/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrUnauthenticated is returned for requests without a token or with a token that is not valid.
+var ErrUnauthenticated = errors.New("a valid bearer token is required")
+
+// User is the identity a token belongs to.
+type User struct {
+	Name   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+}
+
+// Authenticator identifies the user a bearer token belongs to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (User, error)
+}
+
+// Token returns the token presented with the request, as a bearer token or in the X-API-Token
+// header.
+func Token(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer
+	}
+	return r.Header.Get("X-API-Token")
+}
+
+// staticToken is a token with the user it belongs to.
+type staticToken struct {
+	token string
+	user  User
+}
+
+// Static authenticates a fixed set of tokens, for running without a cluster.
+type Static struct {
+	tokens []staticToken
+}
+
+// NewStatic returns a Static authenticator without any tokens, which refuses every request.
+func NewStatic() *Static {
+	return &Static{}
+}
+
+// Add accepts token as user. Empty tokens are ignored.
+func (s *Static) Add(token string, user User) {
+	if token != "" {
+		s.tokens = append(s.tokens, staticToken{token: token, user: user})
+	}
+}
+
+// Len returns the number of tokens accepted.
+func (s *Static) Len() int {
+	return len(s.tokens)
+}
+
+// ReadTokenFile adds the tokens in the file at path, in the format of the Kubernetes static token
+// file: one token per line as token,user,uid followed by an optional quoted, comma separated list
+// of groups. Empty lines and lines starting with # are skipped.
+func (s *Static) ReadTokenFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) < 3 || record[0] == "" || record[1] == "" {
+			return fmt.Errorf("%s:%d: want token,user,uid[,groups]", path, line)
+		}
+
+		user := User{Name: record[1], UID: record[2]}
+		if len(record) > 3 && record[3] != "" {
+			user.Groups = strings.Split(record[3], ",")
+		}
+		s.Add(record[0], user)
+	}
+}
+
+func (s *Static) Authenticate(ctx context.Context, token string) (User, error) {
+	if token == "" {
+		return User{}, ErrUnauthenticated
+	}
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) == 1 {
+			return t.user, nil
+		}
+	}
+	return User{}, ErrUnauthenticated
+}
+
+// tokenReview authenticates tokens with the Kubernetes API server.
+type tokenReview struct {
+	client    kubernetes.Interface
+	audiences []string
+}
+
+// NewTokenReview returns an Authenticator that validates tokens by creating a TokenReview, so any
+// token the cluster accepts, such as a service account token or an OIDC token, can be used. When
+// audiences is not empty the token must be issued for one of them.
+func NewTokenReview(client kubernetes.Interface, audiences []string) Authenticator {
+	return &tokenReview{client: client, audiences: audiences}
+}
+
+func (t *tokenReview) Authenticate(ctx context.Context, token string) (User, error) {
+	if token == "" {
+		return User{}, ErrUnauthenticated
+	}
+	review, err := t.client.AuthenticationV1().TokenReviews().Create(ctx, &authentication.TokenReview{
+		Spec: authentication.TokenReviewSpec{Token: token, Audiences: t.audiences},
+	}, meta.CreateOptions{})
+	if err != nil {
+		return User{}, fmt.Errorf("token review: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return User{}, ErrUnauthenticated
+	}
+	user := User{
+		Name:   review.Status.User.Username,
+		UID:    review.Status.User.UID,
+		Groups: review.Status.User.Groups,
+	}
+	if len(review.Status.User.Extra) > 0 {
+		user.Extra = make(map[string][]string, len(review.Status.User.Extra))
+		for key, values := range review.Status.User.Extra {
+			user.Extra[key] = values
+		}
+	}
+	return user, nil
+}
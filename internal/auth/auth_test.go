@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	authentication "k8s.io/api/authentication/v1"
+	authorization "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestStaticTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	content := "# operators\nt0k3n,alice,1001,\"sre,auditors\"\n\nr3ad,bob,1002\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	static := NewStatic()
+	static.Add("", User{Name: "nobody"})
+	if err := static.ReadTokenFile(path); err != nil {
+		t.Fatalf("ReadTokenFile() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		token string
+		user  User
+		err   error
+	}{
+		{"t0k3n", User{Name: "alice", UID: "1001", Groups: []string{"sre", "auditors"}}, nil},
+		{"r3ad", User{Name: "bob", UID: "1002"}, nil},
+		{"wrong", User{}, ErrUnauthenticated},
+		{"", User{}, ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		user, err := static.Authenticate(context.Background(), tt.token)
+		if !errors.Is(err, tt.err) || !reflect.DeepEqual(user, tt.user) {
+			t.Errorf("Authenticate(%q) returned incorrect value, got %+v, %v, wanted %+v, %v", tt.token, user, err, tt.user, tt.err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("t0k3n,alice\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewStatic().ReadTokenFile(path); err == nil {
+		t.Errorf("ReadTokenFile() of a line without uid returned no error")
+	}
+}
+
+func TestTokenReview(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authentication.TokenReview)
+		if review.Spec.Token == "valid" && reflect.DeepEqual(review.Spec.Audiences, []string{"webhook"}) {
+			review.Status.Authenticated = true
+			review.Status.User = authentication.UserInfo{Username: "system:serviceaccount:ops:reporter", Groups: []string{"system:serviceaccounts"}}
+		}
+		return true, review, nil
+	})
+	authenticator := NewTokenReview(client, []string{"webhook"})
+
+	user, err := authenticator.Authenticate(context.Background(), "valid")
+	if err != nil || user.Name != "system:serviceaccount:ops:reporter" || len(user.Groups) != 1 {
+		t.Errorf("Authenticate() returned incorrect value, got %+v, %v", user, err)
+	}
+	for _, token := range []string{"invalid", ""} {
+		if _, err := authenticator.Authenticate(context.Background(), token); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("Authenticate(%q) returned incorrect error, got %v, wanted %v", token, err, ErrUnauthenticated)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	tests := map[string]map[string]string{
+		"bearer": {"Authorization": "Bearer bearer", "X-API-Token": "header"},
+		"header": {"X-API-Token": "header"},
+		"":       {"Authorization": "Basic dXNlcjpwYXNz"},
+	}
+	for want, headers := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if got := Token(req); got != want {
+			t.Errorf("Token() returned incorrect value, got %v, wanted %v", got, want)
+		}
+	}
+}
+
+func TestSubjectAccessReview(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorization.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "alice" && attrs.Group == Group && attrs.Resource == "reports" && attrs.Verb == "get"
+		return true, review, nil
+	})
+	authorizer := NewSubjectAccessReview(client)
+	report := Attributes{Verb: "get", Resource: "reports", Name: "drift"}
+
+	if err := authorizer.Authorize(context.Background(), User{Name: "alice"}, report); err != nil {
+		t.Errorf("Authorize() returned an error: %v", err)
+	}
+	if err := authorizer.Authorize(context.Background(), User{Name: "bob"}, report); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() returned incorrect error, got %v, wanted %v", err, ErrForbidden)
+	}
+	if err := authorizer.Authorize(context.Background(), User{Name: "alice"}, Attributes{Verb: "update", Resource: "bypass"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() returned incorrect error, got %v, wanted %v", err, ErrForbidden)
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authorization "k8s.io/api/authorization/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Group is the API group of the virtual resources the admin API is authorized against. Nothing is
+// served under it; it only gives RBAC rules something to name.
+const Group = "admin.custom-labels-webhook.io"
+
+// ErrForbidden is returned for authenticated users that may not perform a request.
+var ErrForbidden = errors.New("not allowed")
+
+// Attributes describe the access to a virtual resource a request needs.
+type Attributes struct {
+	Verb        string
+	Resource    string
+	Subresource string
+	Name        string
+}
+
+func (a Attributes) String() string {
+	resource := a.Resource
+	if a.Subresource != "" {
+		resource += "/" + a.Subresource
+	}
+	if a.Name != "" {
+		resource += " " + a.Name
+	}
+	return a.Verb + " " + resource
+}
+
+// Authorizer decides whether a user may perform a request. It returns ErrForbidden when the user
+// may not, and other errors when no decision could be made.
+type Authorizer interface {
+	Authorize(ctx context.Context, user User, attrs Attributes) error
+}
+
+// AllowAll returns an Authorizer that allows every authenticated user everything, for use with
+// static tokens.
+func AllowAll() Authorizer {
+	return allowAll{}
+}
+
+type allowAll struct{}
+
+func (allowAll) Authorize(ctx context.Context, user User, attrs Attributes) error {
+	return nil
+}
+
+// subjectAccessReview authorizes requests with the Kubernetes API server.
+type subjectAccessReview struct {
+	client kubernetes.Interface
+}
+
+// NewSubjectAccessReview returns an Authorizer that asks the API server, with a
+// SubjectAccessReview, whether the user may perform the verb on the virtual resource in Group, so
+// access is granted with ordinary RBAC roles.
+func NewSubjectAccessReview(client kubernetes.Interface) Authorizer {
+	return &subjectAccessReview{client: client}
+}
+
+func (s *subjectAccessReview) Authorize(ctx context.Context, user User, attrs Attributes) error {
+	extra := make(map[string]authorization.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = values
+	}
+
+	review, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorization.SubjectAccessReview{
+		Spec: authorization.SubjectAccessReviewSpec{
+			User:   user.Name,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorization.ResourceAttributes{
+				Group:       Group,
+				Resource:    attrs.Resource,
+				Subresource: attrs.Subresource,
+				Name:        attrs.Name,
+				Verb:        attrs.Verb,
+			},
+		},
+	}, meta.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("subject access review: %w", err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("%w to %s %s", ErrForbidden, attrs, Group)
+	}
+	return nil
+}
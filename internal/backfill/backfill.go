@@ -0,0 +1,234 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/operations"
+)
+
+// fieldManager identifies the webhook as the writer of the patched labels.
+const fieldManager = "appid-webhook"
+
+// pageSize bounds the number of objects returned by a single list call.
+const pageSize = 500
+
+// Options control a backfill run.
+type Options struct {
+	// DryRun reports what would be patched without patching anything.
+	DryRun bool
+	// Selector restricts the pods and workloads considered, in label selector syntax.
+	Selector string
+	// Workloads also labels Deployments, StatefulSets, DaemonSets, Jobs and CronJobs. Only the
+	// object metadata is patched, never the pod template, so no rollout is triggered.
+	Workloads bool
+	// QPS and Burst rate limit the patch requests sent to the API server.
+	QPS   float32
+	Burst int
+}
+
+// KindReport counts the outcome for one kind of object.
+type KindReport struct {
+	Scanned  int `json:"scanned"`
+	UpToDate int `json:"upToDate"`
+	Missing  int `json:"missing"`
+	Stale    int `json:"stale"`
+	Patched  int `json:"patched"`
+	Failed   int `json:"failed"`
+}
+
+// Report summarizes a backfill run.
+type Report struct {
+	DryRun             bool                   `json:"dryRun"`
+	Namespaces         int                    `json:"namespaces"`
+	ExcludedNamespaces int                    `json:"excludedNamespaces"`
+	NamespacesNoAppID  []string               `json:"namespacesWithoutAppID,omitempty"`
+	Kinds              map[string]*KindReport `json:"kinds"`
+	Errors             []string               `json:"errors,omitempty"`
+}
+
+// Run labels existing pods, and optionally workloads, in every non-excluded namespace with the
+// appid of their namespace. Missing labels are added and stale labels are replaced. Errors on
+// individual objects are recorded in the report and do not stop the run.
+func Run(ctx context.Context, client kubernetes.Interface, cfg *config.Config, opts Options) (*Report, error) {
+	report := &Report{
+		DryRun: opts.DryRun,
+		Kinds:  make(map[string]*KindReport),
+	}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, meta.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	r := &runner{
+		client:  client,
+		cfg:     cfg,
+		opts:    opts,
+		report:  report,
+		limiter: flowcontrol.NewTokenBucketRateLimiter(opts.QPS, opts.Burst),
+	}
+	defer r.limiter.Stop()
+
+	for i := range namespaces.Items {
+		if err := r.namespace(ctx, &namespaces.Items[i]); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// Total returns the counts of every kind added up.
+func (r *Report) Total() KindReport {
+	var total KindReport
+	for _, kr := range r.Kinds {
+		total.Scanned += kr.Scanned
+		total.UpToDate += kr.UpToDate
+		total.Missing += kr.Missing
+		total.Stale += kr.Stale
+		total.Patched += kr.Patched
+		total.Failed += kr.Failed
+	}
+	return total
+}
+
+// Drifted returns the number of objects whose appid label is missing or stale and was not patched.
+func (r *Report) Drifted() int {
+	total := r.Total()
+	return total.Missing + total.Stale - total.Patched
+}
+
+// Log writes a summary of the report.
+func (r *Report) Log() {
+	for kind, kr := range r.Kinds {
+		slog.Info("Backfill summary", "kind", kind, "dryRun", r.DryRun, "scanned", kr.Scanned, "upToDate", kr.UpToDate,
+			"missing", kr.Missing, "stale", kr.Stale, "patched", kr.Patched, "failed", kr.Failed)
+	}
+	if len(r.NamespacesNoAppID) > 0 {
+		slog.Warn("Namespaces without an appid were skipped", "namespaces", r.NamespacesNoAppID)
+	}
+}
+
+type runner struct {
+	client  kubernetes.Interface
+	cfg     *config.Config
+	opts    Options
+	report  *Report
+	limiter flowcontrol.RateLimiter
+}
+
+// Namespace labels the objects of a single namespace, for example after its appid changed.
+func Namespace(ctx context.Context, client kubernetes.Interface, cfg *config.Config, ns *core.Namespace, opts Options) (*Report, error) {
+	r := &runner{
+		client:  client,
+		cfg:     cfg,
+		opts:    opts,
+		report:  &Report{DryRun: opts.DryRun, Kinds: make(map[string]*KindReport)},
+		limiter: flowcontrol.NewTokenBucketRateLimiter(opts.QPS, opts.Burst),
+	}
+	defer r.limiter.Stop()
+
+	return r.report, r.namespace(ctx, ns)
+}
+
+func (r *runner) namespace(ctx context.Context, ns *core.Namespace) error {
+	r.report.Namespaces++
+	if r.cfg.IsNamespaceExcluded(ns.Name) {
+		r.report.ExcludedNamespaces++
+		return nil
+	}
+
+	appid, _ := operations.ResolveAppID(ns)
+	if appid == "" {
+		r.report.NamespacesNoAppID = append(r.report.NamespacesNoAppID, ns.Name)
+		return nil
+	}
+
+	for _, t := range targets(r.client, r.opts.Workloads) {
+		if err := r.target(ctx, t, ns.Name, appid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) target(ctx context.Context, t target, namespace, appid string) error {
+	kr, ok := r.report.Kinds[t.kind]
+	if !ok {
+		kr = &KindReport{}
+		r.report.Kinds[t.kind] = kr
+	}
+
+	key := r.cfg.AppIDLabel()
+	opts := meta.ListOptions{LabelSelector: r.opts.Selector, Limit: pageSize}
+	for {
+		objects, next, err := t.list(ctx, namespace, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.report.Errors = append(r.report.Errors, fmt.Sprintf("list %s in %s: %v", t.kind, namespace, err))
+			return nil
+		}
+
+		for _, obj := range objects {
+			kr.Scanned++
+			switch current := obj.GetLabels()[key]; {
+			case current == appid:
+				kr.UpToDate++
+				continue
+			case current == "":
+				kr.Missing++
+			default:
+				kr.Stale++
+			}
+
+			if r.opts.DryRun {
+				slog.Debug("DRY RUN: Would label object", "kind", t.kind, "namespace", namespace, "name", obj.GetName(), "appid", appid)
+				continue
+			}
+
+			if err := r.patch(ctx, t, namespace, obj.GetName(), key, appid); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				kr.Failed++
+				r.report.Errors = append(r.report.Errors, fmt.Sprintf("patch %s %s/%s: %v", t.kind, namespace, obj.GetName(), err))
+				continue
+			}
+			kr.Patched++
+			slog.Info("Labeled object", "kind", t.kind, "namespace", namespace, "name", obj.GetName(), "appid", appid)
+		}
+
+		if next == "" {
+			return nil
+		}
+		opts.Continue = next
+	}
+}
+
+// patch sets the appid label with a merge patch that names only that label, so labels added since
+// the object was listed are left alone.
+func (r *runner) patch(ctx context.Context, t target, namespace, name, key, appid string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{key: appid},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return t.patch(ctx, namespace, name, types.MergePatchType, data, meta.PatchOptions{FieldManager: fieldManager})
+}
@@ -0,0 +1,114 @@
+package backfill
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"mutating-webhook/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	objects := []runtime.Object{
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Labels: map[string]string{"appid": "app-a"}}},
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-b"}},
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "kube-system", Labels: map[string]string{"appid": "system"}}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "missing", Namespace: "team-a"}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "stale", Namespace: "team-a", Labels: map[string]string{"managed-by/appid": "old"}}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "current", Namespace: "team-a", Labels: map[string]string{"managed-by/appid": "app-a"}}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "no-appid", Namespace: "team-b"}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "system", Namespace: "kube-system"}},
+		&apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "team-a"}},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		client := fake.NewSimpleClientset(objects...)
+		cfg := config.Config{LabelPrefix: "managed-by"}
+		cfg.CompileExclusions()
+
+		report, err := Run(context.Background(), client, &cfg, Options{DryRun: dryRun, Workloads: true, QPS: 100, Burst: 100})
+		if err != nil {
+			t.Fatalf("Run() returned an error: %v", err)
+		}
+
+		pods := report.Kinds["Pod"]
+		if pods.Scanned != 3 || pods.Missing != 1 || pods.Stale != 1 || pods.UpToDate != 1 {
+			t.Errorf("Run() returned incorrect pod counts, got %+v", *pods)
+		}
+		wantPatched := 2
+		if dryRun {
+			wantPatched = 0
+		}
+		if pods.Patched != wantPatched {
+			t.Errorf("Run() patched incorrect number of pods, got %d, wanted %d", pods.Patched, wantPatched)
+		}
+		if deployments := report.Kinds["Deployment"]; deployments.Missing != 1 {
+			t.Errorf("Run() returned incorrect deployment counts, got %+v", *deployments)
+		}
+		if len(report.NamespacesNoAppID) != 1 || report.NamespacesNoAppID[0] != "team-b" {
+			t.Errorf("Run() returned incorrect namespaces without appid, got %v, wanted [team-b]", report.NamespacesNoAppID)
+		}
+		if report.ExcludedNamespaces != 1 {
+			t.Errorf("Run() returned incorrect excluded namespace count, got %d, wanted 1", report.ExcludedNamespaces)
+		}
+
+		for _, name := range []string{"missing", "stale"} {
+			pod, err := client.CoreV1().Pods("team-a").Get(context.Background(), name, meta.GetOptions{})
+			if err != nil {
+				t.Fatalf("Get() returned an error: %v", err)
+			}
+			want := "app-a"
+			if dryRun {
+				want = map[string]string{"missing": "", "stale": "old"}[name]
+			}
+			if got := pod.Labels["managed-by/appid"]; got != want {
+				t.Errorf("pod %s has incorrect appid label (dry run %v), got %q, wanted %q", name, dryRun, got, want)
+			}
+		}
+	}
+}
+
+func TestRunPatchesOnlyTheAppIDLabel(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Labels: map[string]string{"appid": "app-a"}}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "missing", Namespace: "team-a"}},
+	)
+	// a label added after the pods were listed must survive the patch
+	client.PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pod, _ := client.Tracker().Get(core.SchemeGroupVersion.WithResource("pods"), "team-a", "missing")
+		updated := pod.(*core.Pod).DeepCopy()
+		updated.Labels = map[string]string{"team": "payments"}
+		if err := client.Tracker().Update(core.SchemeGroupVersion.WithResource("pods"), updated, "team-a"); err != nil {
+			t.Fatal(err)
+		}
+		return true, &core.PodList{Items: []core.Pod{*pod.(*core.Pod)}}, nil
+	})
+	cfg := config.Config{LabelPrefix: "managed-by"}
+	cfg.CompileExclusions()
+
+	if _, err := Run(context.Background(), client, &cfg, Options{QPS: 100, Burst: 100}); err != nil {
+		t.Fatalf("Run() returned an error: %v", err)
+	}
+
+	for _, action := range client.Actions() {
+		if patch, ok := action.(clienttesting.PatchAction); ok && patch.GetPatchType() != types.MergePatchType {
+			t.Errorf("Run() sent incorrect patch type, got %v, wanted %v", patch.GetPatchType(), types.MergePatchType)
+		}
+	}
+	pod, err := client.CoreV1().Pods("team-a").Get(context.Background(), "missing", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"team": "payments", "managed-by/appid": "app-a"}
+	if !reflect.DeepEqual(pod.Labels, want) {
+		t.Errorf("Run() returned incorrect labels, got %v, wanted %v", pod.Labels, want)
+	}
+}
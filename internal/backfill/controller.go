@@ -0,0 +1,46 @@
+package backfill
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"mutating-webhook/internal/config"
+)
+
+// OptionsFromConfig returns the backfill options configured for the webhook.
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		DryRun:    cfg.DryRun,
+		Selector:  cfg.BackfillSelector,
+		Workloads: cfg.LabelAllWorkloads,
+		QPS:       float32(cfg.BackfillQPS),
+		Burst:     cfg.BackfillBurst,
+	}
+}
+
+// RunPeriodically runs a backfill every BackfillInterval until ctx is cancelled. Every run uses the
+// configuration current when it starts. It should only run on the elected replica, so existing
+// objects are not patched once per replica.
+func RunPeriodically(ctx context.Context, client kubernetes.Interface, store *config.Store) {
+	ticker := time.NewTicker(store.Load().BackfillInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg := store.Load()
+		report, err := Run(ctx, client, cfg, OptionsFromConfig(cfg))
+		if err != nil {
+			slog.Error("Backfill failed", "error", err)
+		} else {
+			report.Log()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
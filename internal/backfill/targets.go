@@ -0,0 +1,124 @@
+package backfill
+
+import (
+	"context"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// target lists and patches one kind of object.
+type target struct {
+	kind  string
+	list  func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error)
+	patch func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error
+}
+
+// targets returns the kinds a backfill run labels. Pods always come first.
+func targets(client kubernetes.Interface, workloads bool) []target {
+	t := []target{
+		{
+			kind: "Pod",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.CoreV1().Pods(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.CoreV1().Pods(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+	}
+	if !workloads {
+		return t
+	}
+
+	return append(t,
+		target{
+			kind: "Deployment",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.AppsV1().Deployments(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+		target{
+			kind: "StatefulSet",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.AppsV1().StatefulSets(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+		target{
+			kind: "DaemonSet",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.AppsV1().DaemonSets(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.AppsV1().DaemonSets(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+		target{
+			kind: "Job",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.BatchV1().Jobs(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.BatchV1().Jobs(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+		target{
+			kind: "CronJob",
+			list: func(ctx context.Context, namespace string, opts meta.ListOptions) ([]meta.Object, string, error) {
+				l, err := client.BatchV1().CronJobs(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return objects(l.Items), l.Continue, nil
+			},
+			patch: func(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts meta.PatchOptions) error {
+				_, err := client.BatchV1().CronJobs(namespace).Patch(ctx, name, pt, data, opts)
+				return err
+			},
+		},
+	)
+}
+
+// objects converts a slice of API objects to their metadata accessors.
+func objects[T any, PT interface {
+	*T
+	meta.Object
+}](items []T) []meta.Object {
+	out := make([]meta.Object, len(items))
+	for i := range items {
+		out[i] = PT(&items[i])
+	}
+	return out
+}
@@ -3,7 +3,7 @@ package certificate
 import (
 	"bytes"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"time"
 
@@ -58,6 +58,6 @@ func CreateCA(privateKey string) (string, error) {
 		Bytes: certBytes,
 	})
 
-	log.Printf("[DEBUG] Generated Certificate Authority Certificate:\n%s", c)
+	slog.Debug("Generated Certificate Authority Certificate", "certificate", c.String())
 	return c.String(), nil
 }
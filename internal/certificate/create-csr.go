@@ -2,13 +2,15 @@ package certificate
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"log"
 
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+
+	"mutating-webhook/internal/logging"
 )
 
 func CreateCSR(privateKey string, dnsNames []string) (string, error) {
@@ -47,6 +49,6 @@ func CreateCSR(privateKey string, dnsNames []string) (string, error) {
 		Bytes: csrData,
 	})
 
-	log.Printf("[TRACE] Generated Host CSR:\n%s", c.String())
+	logging.Trace(context.Background(), "Generated Host CSR", "csr", c.String())
 	return c.String(), nil
 }
@@ -1,105 +1,162 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
-	"reflect"
-	"strconv"
 	"time"
 
-	"github.com/hashicorp/logutils"
+	"mutating-webhook/internal/logging"
+)
+
+// Failure policies applied by the webhook when a hook cannot complete. They mirror the values of
+// the failurePolicy field on the webhook registration.
+const (
+	FailurePolicyIgnore = "Ignore"
+	FailurePolicyFail   = "Fail"
+)
+
+// Policies applied by the namespace watcher when the appid of a namespace changes.
+// Admin server authentication modes: static tokens from the configuration, or any token the cluster
+// accepts, validated with a TokenReview.
+const (
+	AdminAuthStatic      = "static"
+	AdminAuthTokenReview = "tokenreview"
+)
+
+const (
+	AppIDChangeIgnore  = "ignore"
+	AppIDChangeFlag    = "flag"
+	AppIDChangeRelabel = "relabel"
 )
 
 type Config struct {
 	// time configuration
-	TimeFormat    string         `env:"time_format" default:"2006-01-02 15:04:05"`
-	TimeZoneLocal string         `env:"time_zone" default:"UTC"`
-	TZoneLocal    *time.Location `ignored:"true"`
-	TZoneUTC      *time.Location `ignored:"true"`
+	TimeFormat    string         `env:"time_format" default:"2006-01-02 15:04:05" yaml:"time-format"`
+	TimeZoneLocal string         `env:"time_zone" default:"UTC" yaml:"time-zone"`
+	TZoneLocal    *time.Location `ignored:"true" yaml:"-"`
+	TZoneUTC      *time.Location `ignored:"true" yaml:"-"`
 
 	// config file
-	ConfigFile string `env:"config_file" default:"/etc/webhook/config.yaml"`
+	ConfigFile           string        `env:"config_file" default:"/etc/webhook/config.yaml" yaml:"-" reload:"false"`
+	ConfigFileRequired   bool          `env:"config_file_required" default:"false" yaml:"-" reload:"false"`
+	ConfigReloadInterval time.Duration `env:"config_reload_interval" default:"10s" yaml:"config-reload-interval" reload:"false"`
 
 	// logging
-	LogLevel int                   `env:"log_level" default:"60"`
-	Log      *logutils.LevelFilter `ignored:"true"`
+	LogLevel  string `env:"log_level" default:"info" yaml:"log-level" reload:"false"`
+	LogFormat string `env:"log_format" default:"text" yaml:"log-format" reload:"false"`
 
 	// webserver
-	WebServerPort         int    `env:"webserver_port" default:"8443"`
-	WebServerIP           string `env:"webserver_ip" default:"0.0.0.0"`
-	WebServerCertificate  string `env:"webserver_cert"`
-	WebServerKey          string `env:"webserver_key"`
-	WebServerReadTimeout  int    `env:"webserver_read_timeout" default:"30"`
-	WebServerWriteTimeout int    `env:"webserver_write_timeout" default:"30"`
-	WebServerIdleTimeout  int    `env:"webserver_idle_timeout" default:"120"`
+	WebServerPort         int           `env:"webserver_port" default:"8443" yaml:"webserver-port" reload:"false"`
+	WebServerIP           string        `env:"webserver_ip" default:"0.0.0.0" yaml:"webserver-ip" reload:"false"`
+	WebServerCertificate  string        `env:"webserver_cert" yaml:"webserver-cert" reload:"false"`
+	WebServerKey          string        `env:"webserver_key" yaml:"webserver-key" reload:"false" secret:"true"`
+	WebServerReadTimeout  time.Duration `env:"webserver_read_timeout" default:"30s" yaml:"webserver-read-timeout" reload:"false"`
+	WebServerWriteTimeout time.Duration `env:"webserver_write_timeout" default:"30s" yaml:"webserver-write-timeout" reload:"false"`
+	WebServerIdleTimeout  time.Duration `env:"webserver_idle_timeout" default:"2m" yaml:"webserver-idle-timeout" reload:"false"`
+
+	// admin server
+	AdminIP        string   `env:"admin_ip" default:"0.0.0.0" yaml:"admin-ip" reload:"false"`
+	AdminPort      int      `env:"admin_port" default:"8444" yaml:"admin-port" reload:"false"`
+	AdminAuth      string   `env:"admin_auth" default:"static" yaml:"admin-auth" reload:"false"`
+	AdminToken     string   `env:"admin_token" yaml:"admin-token" reload:"false" secret:"true"`
+	AdminTokenFile string   `env:"admin_token_file" yaml:"admin-token-file" reload:"false"`
+	AdminAudiences []string `env:"admin_audiences" yaml:"admin-audiences" reload:"false"`
 
 	// admission control configuration
-	DryRun               bool     `env:"dry_run" default:"false"`
-	EnableMetrics        bool     `env:"enable_metrics" default:"true"`
-	MetricsPort          int      `env:"metrics_port" default:"9090"`
-	AllowAdminNoMutate   bool     `env:"allow_admin_nomutate" default:"false"`
-	ExcludedNamespaces   []string `ignored:"true"`
+	DryRun               bool              `env:"dry_run" default:"false" yaml:"dry-run"`
+	EnableMetrics        bool              `env:"enable_metrics" default:"true" yaml:"enable-metrics" reload:"false"`
+	MetricsPort          int               `env:"metrics_port" default:"9090" yaml:"metrics-port" reload:"false"`
+	AllowAdminNoMutate   bool              `env:"allow_admin_nomutate" default:"false" yaml:"allow-admin-nomutate"`
+	ExcludedNamespaces   []string          `env:"excluded_namespaces" yaml:"excluded-namespaces"`
+	ExcludedNamespaceSet NamespaceSet      `ignored:"true" yaml:"-"`
+	HookTimeout          time.Duration     `env:"hook_timeout" default:"5s" yaml:"hook-timeout"`
+	FailurePolicy        string            `env:"failure_policy" default:"Ignore" yaml:"failure-policy"`
+	FailurePolicies      map[string]string `env:"failure_policies" yaml:"failure-policies"`
+
+	// audit configuration
+	AuditSink      string `env:"audit_sink" yaml:"audit-sink" reload:"false"`
+	AuditQueueSize int    `env:"audit_queue_size" default:"1000" yaml:"audit-queue-size" reload:"false"`
+
+	// event configuration
+	EnableEvents  bool          `env:"enable_events" default:"true" yaml:"enable-events" reload:"false"`
+	EventInterval time.Duration `env:"event_interval" default:"5m" yaml:"event-interval" reload:"false"`
+
+	// backfill configuration
+	BackfillInterval time.Duration `env:"backfill_interval" default:"0" yaml:"backfill-interval" reload:"false"`
+	BackfillSelector string        `env:"backfill_selector" yaml:"backfill-selector"`
+	BackfillQPS      int           `env:"backfill_qps" default:"10" yaml:"backfill-qps"`
+	BackfillBurst    int           `env:"backfill_burst" default:"20" yaml:"backfill-burst"`
+
+	// namespace watcher configuration
+	AppIDChangePolicy string `env:"appid_change_policy" default:"flag" yaml:"appid-change-policy" reload:"false"`
 
 	// custom labeling configuration
-	CustomLabels         map[string]string `ignored:"true"`
-	LabelPrefix          string            `env:"label_prefix" default:"managed-by"`
-	Organization         string            `env:"organization" default:"default"`
-	Environment          string            `env:"environment" default:"production"`
-	EnableLabeling       bool              `env:"enable_labeling" default:"true"`
-	LabelAllWorkloads    bool              `env:"label_all_workloads" default:"true"`
+	CustomLabels      map[string]string `env:"custom_labels" yaml:"custom-labels"`
+	LabelPrefix       string            `env:"label_prefix" default:"managed-by" yaml:"label-prefix"`
+	Organization      string            `env:"organization" default:"default" yaml:"organization"`
+	Environment       string            `env:"environment" default:"production" yaml:"environment"`
+	EnableLabeling    bool              `env:"enable_labeling" default:"true" yaml:"enable-labeling"`
+	LabelAllWorkloads bool              `env:"label_all_workloads" default:"true" yaml:"label-all-workloads"`
 
 	// certificate configuration
-	CACert         string `env:"ca_cert"`
-	CAPrivateKey   string `env:"ca_private_key"`
-	CertCert       string `env:"cert_cert"`
-	CertPrivateKey string `env:"cert_private_key"`
+	CACert         string `env:"ca_cert" yaml:"certificate-authority.certificate" reload:"false"`
+	CAPrivateKey   string `env:"ca_private_key" yaml:"certificate-authority.private-key" reload:"false" secret:"true"`
+	CertCert       string `env:"cert_cert" yaml:"certificate.certificate" reload:"false"`
+	CertPrivateKey string `env:"cert_private_key" yaml:"certificate.private-key" reload:"false" secret:"true"`
+
+	// files holding the certificates and keys, read at startup and on reload, see readSecretFiles
+	CACertFile         string `env:"ca_cert_file" yaml:"certificate-authority.certificate-file" reload:"false"`
+	CAPrivateKeyFile   string `env:"ca_private_key_file" yaml:"certificate-authority.private-key-file" reload:"false"`
+	CertCertFile       string `env:"cert_cert_file" yaml:"certificate.certificate-file" reload:"false"`
+	CertPrivateKeyFile string `env:"cert_private_key_file" yaml:"certificate.private-key-file" reload:"false"`
 
 	// kubernetes configuration
-	NameSpace       string `env:"namespace" default:"kube-system"`
-	ServiceName     string `env:"service_name" default:"custom-labels-webhook"`
-	ClusterName     string `env:"cluster_name" default:"openshift-cluster"`
-	WebhookName     string `env:"webhook_name" default:"custom-labels-mutator"`
+	NameSpace   string `env:"namespace" default:"kube-system" yaml:"kubernetes.namespace" reload:"false"`
+	ServiceName string `env:"service_name" default:"custom-labels-webhook" yaml:"kubernetes.service-name" reload:"false"`
+	ClusterName string `env:"cluster_name" default:"openshift-cluster" yaml:"kubernetes.cluster-name"`
+	WebhookName string `env:"webhook_name" default:"custom-labels-mutator" yaml:"kubernetes.webhook-name"`
+
+	// where the value of each setting came from, by field name
+	sources map[string]Source
 }
 
 // DefaultConfig initializes the config variable for use with a prepared set of defaults.
 func DefaultConfig() Config {
-	return Config{
-		Log: &logutils.LevelFilter{
-			Levels: []logutils.LogLevel{"TRACE", "DEBUG", "INFO", "WARNING", "ERROR"},
-			Writer: os.Stderr,
-		},
+	return Config{}
+}
+
+// AppIDLabel returns the key of the label the appid is written to.
+func (c *Config) AppIDLabel() string {
+	return c.LabelPrefix + "/appid"
+}
+
+// FailurePolicyFor returns the failure policy of the named hook, falling back to FailurePolicy when
+// the hook has no policy of its own.
+func (c *Config) FailurePolicyFor(hook string) string {
+	if policy, ok := c.FailurePolicies[hook]; ok {
+		return policy
 	}
+	return c.FailurePolicy
+}
+
+// FailsClosed reports whether requests handled by the named hook should be denied when the hook
+// cannot complete.
+func (c *Config) FailsClosed(hook string) bool {
+	return c.FailurePolicyFor(hook) == FailurePolicyFail
 }
 
-func setLogLevel(cfg Config) {
-	switch {
-	case cfg.LogLevel <= 20:
-		cfg.Log.SetMinLevel(logutils.LogLevel("ERROR"))
-	case cfg.LogLevel > 20 && cfg.LogLevel <= 40:
-		cfg.Log.SetMinLevel(logutils.LogLevel("WARNING"))
-	case cfg.LogLevel > 40 && cfg.LogLevel <= 60:
-		cfg.Log.SetMinLevel(logutils.LogLevel("INFO"))
-	case cfg.LogLevel > 60 && cfg.LogLevel <= 80:
-		cfg.Log.SetMinLevel(logutils.LogLevel("DEBUG"))
-	case cfg.LogLevel > 80:
-		cfg.Log.SetMinLevel(logutils.LogLevel("TRACE"))
+func setupLogging(cfg Config) error {
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
 	}
-	log.SetOutput(cfg.Log)
+	return logging.Setup(os.Stderr, cfg.LogFormat, level)
 }
 
-func printRunningConfig(cfg *Config, cfgInfo []StructInfo) {
-	log.Printf("[DEBUG] Current Running Configuration Values:")
-	for _, info := range cfgInfo {
-		switch info.Type.String() {
-		case "string":
-			p := reflect.ValueOf(cfg).Elem().FieldByName(info.Name).Addr().Interface().(*string)
-			log.Printf("[DEBUG]\t%s\t\t= %s\n", info.Alt, *p)
-		case "bool":
-			p := reflect.ValueOf(cfg).Elem().FieldByName(info.Name).Addr().Interface().(*bool)
-			log.Printf("[DEBUG]\t%s\t\t= %s\n", info.Alt, strconv.FormatBool(*p))
-		case "int":
-			p := reflect.ValueOf(cfg).Elem().FieldByName(info.Name).Addr().Interface().(*int)
-			log.Printf("[DEBUG]\t%s\t\t= %s\n", info.Alt, strconv.FormatInt(int64(*p), 10))
-		}
+func printRunningConfig(cfg *Config) {
+	slog.Debug("Current Running Configuration Values:")
+	for _, setting := range cfg.Dump() {
+		slog.Debug("config", "key", setting.Name, "value", fmt.Sprint(setting.Value), "source", setting.Source)
 	}
 }
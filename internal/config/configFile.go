@@ -1,48 +1,244 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
-
-	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-type configFileStruct struct {
-	AllowAdminNoMutate   bool             `yaml:"allow-admin-nomutate"`
-	ExcludedNamespaces   []string         `yaml:"excluded-namespaces"`
-	CustomLabels         map[string]string `yaml:"custom-labels"`
-	CertificateAuthority CertStruct       `yaml:"certificate-authority"`
-	Certificate          CertStruct       `yaml:"certificate"`
-	Kubernetes           KubernetesStruct `yaml:"kubernetes"`
+// The configuration file sets any Config field through the key in its yaml tag. Keys containing a
+// dot are nested under a section, so `yaml:"kubernetes.namespace"` is set by
+//
+//	kubernetes:
+//	  namespace: webhook-system
+//
+// The file is decoded into a struct generated from these tags with a pointer per key, which lets
+// yaml.v3 reject unknown keys through KnownFields and tells set keys apart from zero values.
+
+// fileKey is a configuration file key and the index of the Config field it sets.
+type fileKey struct {
+	path  []string
+	index []int
 }
 
-type CertStruct struct {
-	Certificate string `yaml:"certificate"`
-	PrivateKey  string `yaml:"private-key"`
-	PublicKey   string `yaml:"public-key"`
+// fileDuration decodes a duration written either as a Go duration, 1m30s, or a bare number of
+// seconds. yaml.v3 would otherwise read a bare number as nanoseconds.
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: cannot read a duration from a %s", node.Line, nodeKind(node))
+	}
+	v, err := parseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = fileDuration(v)
+	return nil
 }
 
-type KubernetesStruct struct {
-	Namespace   string `yaml:"namespace"`
-	ServiceName string `yaml:"service-name"`
+func nodeKind(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.MappingNode:
+		return "map"
+	}
+	return "value"
 }
 
-func getConfigFileData(fileLocation string) (configFileStruct, error) {
-	// does file exist
-	if _, err := os.Stat(fileLocation); os.IsNotExist(err) {
-		return configFileStruct{}, err
+// getConfigFileData reads the file at the host path fileLocation from fsys, see fsPath.
+func getConfigFileData(fsys fs.FS, fileLocation string) ([]byte, error) {
+	name, err := fsPath(fileLocation)
+	if err != nil {
+		return nil, err
 	}
-	// read file
-	rd, err := ioutil.ReadFile(fileLocation)
+	return fs.ReadFile(fsys, name)
+}
+
+// HostFS is the file system of the host, rooted at /, for Load.
+var HostFS = os.DirFS("/")
+
+// fsPath returns the name of the host path p in a file system rooted at /, such as HostFS. A
+// relative path is taken relative to the working directory.
+func fsPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
 	if err != nil {
-		return configFileStruct{}, err
+		return "", err
+	}
+	name := strings.TrimPrefix(filepath.ToSlash(abs), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, nil
+}
+
+// applyConfigFile sets the fields of cfg for every key present in the YAML configuration data.
+// Keys that do not belong to any field are rejected.
+func applyConfigFile(cfg *Config, data []byte) error {
+	_, err := decodeFile(cfg, data)
+	return err
+}
+
+// decodeFile sets the fields of the struct spec points to for every key present in the data, and
+// returns the indexes of the fields it set.
+func decodeFile(spec interface{}, data []byte) ([][]int, error) {
+	target := reflect.ValueOf(spec).Elem()
+	keys := fileKeys(target.Type(), nil, nil)
+	file := reflect.New(fileStructType(target.Type(), keys, 0))
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file.Interface()); err != nil && !errors.Is(err, io.EOF) {
+		return nil, clarifyFileError(err)
+	}
+
+	return setFromFile(target, file.Elem()), nil
+}
+
+// fileKeys returns the keys of every field of t with a yaml tag. The fields of a nested struct are
+// keys in the section named by the tag of the struct field.
+func fileKeys(t reflect.Type, index []int, path []string) []fileKey {
+	keys := make([]fileKey, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+
+		k := fileKey{
+			path:  append(append([]string{}, path...), strings.Split(key, ".")...),
+			index: append(append([]int{}, index...), i),
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			keys = append(keys, fileKeys(ft, k.index, k.path)...)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// fileStructType builds the struct the file is decoded into for the keys at the given depth. Leaf
+// fields are named after the index of the field they set, F<index>, and sections S<n>.
+func fileStructType(t reflect.Type, keys []fileKey, depth int) reflect.Type {
+	sections := map[string][]fileKey{}
+	var fields []reflect.StructField
+
+	for _, key := range keys {
+		name := key.path[depth]
+		if len(key.path) == depth+1 {
+			leaf := t.FieldByIndex(key.index).Type
+			if leaf == durationType {
+				leaf = reflect.TypeOf(fileDuration(0))
+			}
+			fields = append(fields, reflect.StructField{
+				Name: "F" + fileIndex(key.index),
+				Type: reflect.PointerTo(leaf),
+				Tag:  reflect.StructTag(`yaml:"` + name + `"`),
+			})
+			continue
+		}
+		sections[name] = append(sections[name], key)
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		fields = append(fields, reflect.StructField{
+			Name: "S" + strconv.Itoa(i),
+			Type: reflect.PointerTo(fileStructType(t, sections[name], depth+1)),
+			Tag:  reflect.StructTag(`yaml:"` + name + `"`),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// fileIndex encodes a field index in the name of a generated field, 3_1 for []int{3, 1}.
+func fileIndex(index []int) string {
+	parts := make([]string, len(index))
+	for i, n := range index {
+		parts[i] = strconv.Itoa(n)
 	}
-	// convert config file data to struct
-	var output configFileStruct
-	if err := yaml.Unmarshal(rd, &output); err != nil {
-		return output, err
+	return strings.Join(parts, "_")
+}
+
+// setFromFile copies every key set in the decoded file into the target struct, and returns the
+// indexes of the fields it set.
+func setFromFile(target, file reflect.Value) [][]int {
+	var set [][]int
+	for i := 0; i < file.NumField(); i++ {
+		value := file.Field(i)
+		if value.IsNil() {
+			continue
+		}
+
+		name := file.Type().Field(i).Name
+		if name[0] == 'S' {
+			set = append(set, setFromFile(target, value.Elem())...)
+			continue
+		}
+		var index []int
+		for _, part := range strings.Split(name[1:], "_") {
+			n, _ := strconv.Atoi(part)
+			index = append(index, n)
+		}
+		dst := fieldByIndex(target, index)
+		dst.Set(value.Elem().Convert(dst.Type()))
+		set = append(set, index)
 	}
+	return set
+}
 
-	return output, nil
+// fieldByIndex returns the nested field at index, allocating nil struct pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, n := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(n)
+	}
+	return v
+}
+
+// unknownFieldPattern matches the yaml.v3 error for an unknown key, which names the generated
+// struct type.
+var unknownFieldPattern = regexp.MustCompile(`field (\S+) not found in type struct.*$`)
+
+// clarifyFileError rewrites the errors of yaml.v3 so they name the unknown key instead of the
+// generated struct type.
+func clarifyFileError(err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	msgs := make([]string, len(typeErr.Errors))
+	for i, msg := range typeErr.Errors {
+		msgs[i] = unknownFieldPattern.ReplaceAllString(msg, `unknown key "$1"`)
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
 }
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// Source is where the value of a setting came from.
+type Source string
+
+const (
+	SourceDefault   Source = "default"
+	SourceFile      Source = "file"
+	SourceEnv       Source = "env"
+	SourceFlag      Source = "flag"
+	SourceGenerated Source = "generated"
+)
+
+// redacted replaces the value of secret settings that are set.
+const redacted = "[REDACTED]"
+
+// Setting is a configuration setting as shown by Dump.
+type Setting struct {
+	Name   string      `json:"name"`
+	Env    string      `json:"env,omitempty"`
+	Key    string      `json:"key,omitempty"`
+	Value  interface{} `json:"value"`
+	Source Source      `json:"source"`
+	Secret bool        `json:"secret,omitempty"`
+}
+
+// Dump returns every setting with its effective value and where it came from. The values of fields
+// tagged secret:"true" are redacted, so the result is safe to log or serve.
+func (c *Config) Dump() []Setting {
+	copied := *c
+	cfgInfo, _ := getStructInfo(&copied)
+
+	settings := make([]Setting, 0, len(cfgInfo))
+	for _, info := range cfgInfo {
+		setting := Setting{
+			Name:   info.Name,
+			Env:    info.Alt,
+			Key:    info.Tags.Get("yaml"),
+			Value:  dumpValue(reflect.ValueOf(c).Elem().FieldByIndex(info.Index)),
+			Source: c.Source(info.Name),
+			Secret: info.Tags.Get("secret") == "true",
+		}
+		if setting.Key == "-" {
+			setting.Key = ""
+		}
+		if setting.Secret && setting.Value != "" {
+			setting.Value = redacted
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// Source returns where the value of the named setting came from.
+func (c *Config) Source(name string) Source {
+	if source, ok := c.sources[name]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// dumpValue returns the value shown for a field. Durations are shown as text, 1m30s, instead of a
+// number of nanoseconds.
+func dumpValue(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
+
+// valueSources determines where the value of every field came from, from the highest precedence
+// down: the flags that were given, the environment, the fields set by the configuration file and
+// finally the defaults.
+func valueSources(cfgInfo []StructInfo, flags []*fieldFlag, env func(string) (string, bool), file [][]int) map[string]Source {
+	given := make(map[string]bool)
+	for _, f := range flags {
+		if f.set {
+			given[f.info.Name] = true
+		}
+	}
+	fromFile := make(map[string]bool)
+	for _, index := range file {
+		fromFile[fileIndex(index)] = true
+	}
+
+	sources := make(map[string]Source, len(cfgInfo))
+	for _, info := range cfgInfo {
+		sources[info.Name] = SourceDefault
+		if given[info.Name] {
+			sources[info.Name] = SourceFlag
+		} else if _, ok := env(info.Alt); ok && info.Alt != "" {
+			sources[info.Name] = SourceEnv
+		} else if fromFile[fileIndex(info.Index)] {
+			sources[info.Name] = SourceFile
+		}
+	}
+	return sources
+}
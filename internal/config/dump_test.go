@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDump(t *testing.T) {
+	env := map[string]string{
+		"CONFIG_FILE":  "/config.yaml",
+		"ORGANIZATION": "env",
+		"ADMIN_TOKEN":  "s3cret",
+	}
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("environment: file\nexcluded-namespaces: [legacy]\ncustom-labels:\n  team: platform\n")},
+	}
+	cfg, _, err := Load([]string{"-DryRun"}, func(key string) (string, bool) { v, ok := env[key]; return v, ok }, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]Setting{}
+	for _, s := range cfg.Dump() {
+		settings[s.Name] = s
+	}
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		source Source
+	}{
+		{"DryRun", true, SourceFlag},
+		{"Organization", "env", SourceEnv},
+		{"Environment", "file", SourceFile},
+		{"LabelPrefix", "managed-by", SourceDefault},
+		{"HookTimeout", (5 * time.Second).String(), SourceDefault},
+		{"AdminToken", redacted, SourceEnv},
+		{"CertPrivateKey", "", SourceDefault},
+	}
+	for _, tt := range tests {
+		s, ok := settings[tt.name]
+		if !ok {
+			t.Errorf("Dump() is missing %s", tt.name)
+			continue
+		}
+		if s.Value != tt.value || s.Source != tt.source {
+			t.Errorf("Dump() returned incorrect value for %s, got %v from %s, wanted %v from %s", tt.name, s.Value, s.Source, tt.value, tt.source)
+		}
+	}
+
+	if s := settings["ExcludedNamespaces"]; s.Source != SourceFile || len(s.Value.([]string)) != 1 {
+		t.Errorf("Dump() returned incorrect value for ExcludedNamespaces, got %v from %s", s.Value, s.Source)
+	}
+	if s := settings["CustomLabels"]; s.Value.(map[string]string)["team"] != "platform" {
+		t.Errorf("Dump() returned incorrect value for CustomLabels, got %v", s.Value)
+	}
+	if !settings["AdminToken"].Secret || settings["AdminToken"].Key != "admin-token" || settings["AdminToken"].Env != "ADMIN_TOKEN" {
+		t.Errorf("Dump() returned incorrect metadata for AdminToken, got %+v", settings["AdminToken"])
+	}
+}
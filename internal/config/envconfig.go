@@ -5,18 +5,26 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type StructInfo struct {
 	Name         string
 	Alt          string
 	Key          string
+	Index        []int
 	Field        reflect.Value
 	Tags         reflect.StructTag
 	Type         reflect.Type
 	DefaultValue interface{}
 }
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// getStructInfo returns the settable fields of the struct spec points to. The fields of nested
+// structs are included with their names joined by a dot and their environment variables prefixed
+// by the env tag, or name, of the struct field, so Kubernetes.Namespace is set by
+// KUBERNETES_NAMESPACE.
 func getStructInfo(spec interface{}) ([]StructInfo, error) {
 	s := reflect.ValueOf(spec)
 
@@ -28,6 +36,10 @@ func getStructInfo(spec interface{}) ([]StructInfo, error) {
 	if s.Kind() != reflect.Struct {
 		return []StructInfo{}, fmt.Errorf("getStructInfo() was sent a %s instead of a struct.\n", s.Kind())
 	}
+	return structInfo(s, nil, "", "")
+}
+
+func structInfo(s reflect.Value, index []int, name, prefix string) ([]StructInfo, error) {
 	typeOfSpec := s.Type()
 
 	infos := make([]StructInfo, 0, s.NumField())
@@ -51,9 +63,10 @@ func getStructInfo(spec interface{}) ([]StructInfo, error) {
 		}
 
 		info := StructInfo{
-			Name:  ftype.Name,
+			Name:  name + ftype.Name,
 			Alt:   strings.ToUpper(ftype.Tag.Get("env")),
 			Key:   ftype.Name,
+			Index: append(append([]int{}, index...), i),
 			Field: f,
 			Tags:  ftype.Tag,
 			Type:  ftype.Type,
@@ -61,21 +74,99 @@ func getStructInfo(spec interface{}) ([]StructInfo, error) {
 		if info.Alt != "" {
 			info.Key = info.Alt
 		}
-		info.Key = strings.ToUpper(info.Key)
-		if ftype.Tag.Get("default") != "" {
-			v, err := typeConversion(ftype.Type.String(), getOSEnv(ftype.Tag.Get("env"), ftype.Tag.Get("default")))
+		info.Key = prefix + strings.ToUpper(info.Key)
+		if info.Alt != "" {
+			info.Alt = prefix + info.Alt
+		}
+
+		if f.Kind() == reflect.Struct {
+			nested, err := structInfo(f, info.Index, info.Name+".", info.Key+"_")
 			if err != nil {
 				return []StructInfo{}, err
 			}
-			info.DefaultValue = v
-		} else {
-			info.DefaultValue = getOSEnv(ftype.Tag.Get("env"), "")
+			infos = append(infos, nested...)
+			continue
+		}
+
+		if ftype.Tag.Get("default") != "" {
+			v, err := parseValue(ftype.Type, ftype.Tag.Get("default"))
+			if err != nil {
+				return []StructInfo{}, fmt.Errorf("default of %s: %w", info.Name, err)
+			}
+			info.DefaultValue = v.Interface()
 		}
 		infos = append(infos, info)
 	}
 	return infos, nil
 }
 
+// parseValue converts v to a value of type t. Slices are comma separated lists of their elements,
+// a,b,c, and maps comma separated key=value pairs, k=v,k2=v2. Durations are either Go durations,
+// 1m30s, or a bare number of seconds.
+func parseValue(t reflect.Type, v string) (reflect.Value, error) {
+	switch {
+	case t == durationType:
+		d, err := parseDuration(v)
+		return reflect.ValueOf(d), err
+	case t.Kind() == reflect.Slice:
+		items := splitList(v)
+		slice := reflect.MakeSlice(t, 0, len(items))
+		for _, item := range items {
+			e, err := parseValue(t.Elem(), item)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice = reflect.Append(slice, e)
+		}
+		return slice, nil
+	case t.Kind() == reflect.Map:
+		items := splitList(v)
+		m := reflect.MakeMapWithSize(t, len(items))
+		for _, item := range items {
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("%q is not a key=value pair", item)
+			}
+			k, err := parseValue(t.Key(), strings.TrimSpace(key))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			e, err := parseValue(t.Elem(), strings.TrimSpace(value))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(k, e)
+		}
+		return m, nil
+	}
+
+	x, err := typeConversion(t.Kind().String(), v)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(x).Convert(t), nil
+}
+
+// parseDuration parses a Go duration, accepting a bare number as seconds so settings that used to
+// be whole seconds keep their meaning.
+func parseDuration(v string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// splitList splits a comma separated list, dropping surrounding spaces and empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func typeConversion(t, v string) (interface{}, error) {
 	switch t {
 	case "string":
@@ -92,6 +183,8 @@ func typeConversion(t, v string) (interface{}, error) {
 		return strconv.ParseInt(v, 10, 64)
 	case "uint":
 		return strconv.ParseUint(v, 10, 0)
+	case "uint8":
+		return strconv.ParseUint(v, 10, 8)
 	case "uint16":
 		return strconv.ParseUint(v, 10, 16)
 	case "uint32":
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"text", "text"},
+		{"true", true},
+		{"-3", int(-3)},
+		{"200", uint8(200)},
+		{"1.5", float32(1.5)},
+		{"90", 90 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"a, b,,c", []string{"a", "b", "c"}},
+		{"", []string{}},
+		{"1,2", []int{1, 2}},
+		{"team=a, tier = web", map[string]string{"team": "a", "tier": "web"}},
+		{"fast=1s,slow=1m", map[string]time.Duration{"fast": time.Second, "slow": time.Minute}},
+	}
+
+	for _, tt := range tests {
+		result, err := parseValue(reflect.TypeOf(tt.expected), tt.value)
+		if err != nil {
+			t.Errorf("parseValue(%q) returned an error: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Interface(), tt.expected) {
+			t.Errorf("parseValue(%q) returned incorrect value, got %#v, wanted %#v", tt.value, result.Interface(), tt.expected)
+		}
+	}
+}
+
+func TestParseValueErrors(t *testing.T) {
+	tests := []struct {
+		value string
+		t     interface{}
+	}{
+		{"soon", time.Duration(0)},
+		{"300", uint8(0)},
+		{"a", []int{}},
+		{"team", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseValue(reflect.TypeOf(tt.t), tt.value); err == nil {
+			t.Errorf("parseValue(%q) into %T returned no error", tt.value, tt.t)
+		}
+	}
+}
+
+// TestNestedStructs checks that the fields of nested structs are set by prefixed environment
+// variables, dotted flags and file sections.
+func TestNestedStructs(t *testing.T) {
+	type server struct {
+		Port    int           `env:"port" default:"8443" yaml:"port"`
+		Timeout time.Duration `env:"timeout" default:"30s" yaml:"timeout"`
+	}
+	var spec struct {
+		Name   string  `env:"name" yaml:"name"`
+		Admin  server  `env:"admin" yaml:"admin"`
+		Public *server `yaml:"public"`
+	}
+
+	cfgInfo, err := getStructInfo(&spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, keys []string
+	for _, info := range cfgInfo {
+		names = append(names, info.Name)
+		keys = append(keys, info.Alt)
+	}
+	expectedNames := []string{"Name", "Admin.Port", "Admin.Timeout", "Public.Port", "Public.Timeout"}
+	expectedKeys := []string{"NAME", "ADMIN_PORT", "ADMIN_TIMEOUT", "PUBLIC_PORT", "PUBLIC_TIMEOUT"}
+	if !reflect.DeepEqual(names, expectedNames) || !reflect.DeepEqual(keys, expectedKeys) {
+		t.Fatalf("getStructInfo() returned incorrect fields, got %v %v, wanted %v %v", names, keys, expectedNames, expectedKeys)
+	}
+
+	if err := setDefaults(&spec, cfgInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeFile(&spec, []byte("public:\n  port: 9443\n  timeout: 10\n")); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"ADMIN_PORT": "8080"}
+	if err := applyEnv(&spec, cfgInfo, func(key string) (string, bool) { v, ok := env[key]; return v, ok }); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Admin.Port != 8080 || spec.Admin.Timeout != 30*time.Second {
+		t.Errorf("Admin has incorrect value, got %+v", spec.Admin)
+	}
+	if spec.Public.Port != 9443 || spec.Public.Timeout != 10*time.Second {
+		t.Errorf("Public has incorrect value, got %+v", *spec.Public)
+	}
+}
@@ -2,16 +2,22 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"mutating-webhook/internal/certificate"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"reflect"
 	"strings"
 	"time"
+
+	"mutating-webhook/internal/certificate"
+	"mutating-webhook/internal/logging"
 )
 
 func getOSEnv(env, def string) string {
@@ -21,113 +27,267 @@ func getOSEnv(env, def string) string {
 	return def
 }
 
-// Init initializes the application configuration by reading default values from the struct's tags
-// and environment variables. Tags processed by this process are as follows:
-// `ignored:"true" env:"ENVIRONMENT_VARIABLE" default:"default value"`
-func Init() Config {
+// Init initializes the application configuration from the command line, the environment and the
+// configuration file, and exits when it is invalid. It registers the configuration flags on
+// flag.CommandLine so subcommands can define flags of their own before calling it, sets up logging
+// and generates the certificates that were not configured. The returned Store reloads with the
+// same flags. See Load for the precedence rules.
+func Init() *Store {
+	cfgInfo, err := getStructInfo(&Config{})
+	if err != nil {
+		logging.Fatal("Unable to read configuration structure", "error", err)
+	}
+	flags := registerFlags(flag.CommandLine, cfgInfo)
+	flag.Parse()
+
+	// hand the configuration flags that were given to Load, and to the Store for every reload
+	var args []string
+	for _, f := range flags {
+		if f.set {
+			args = append(args, "-"+f.info.Name+"="+f.value)
+		}
+	}
+
+	cfg, warnings, err := Load(args, os.LookupEnv, HostFS)
+	var problems ValidationErrors
+	if errors.As(err, &problems) {
+		for _, problem := range problems {
+			slog.Error("Invalid configuration", "problem", problem)
+		}
+		logging.Fatal("Unable to load configuration", "problems", len(problems))
+	}
+	if err != nil {
+		logging.Fatal("Unable to load configuration", "error", err)
+	}
+
+	// set logging level and format
+	if err := setupLogging(cfg); err != nil {
+		logging.Fatal("Unable to configure logging", "error", err)
+	}
+	for _, warning := range warnings {
+		slog.Warn("Configuration warning", "warning", warning)
+	}
+	time.Now().Format(cfg.TimeFormat)
+
+	// Generate certificates if needed
+	if err := certificateInit(&cfg); err != nil {
+		logging.Fatal("Unable to initialize certificate data", "error", err)
+	}
+
+	// print running config
+	printRunningConfig(&cfg)
+
+	slog.Info("initialization sequence complete")
+	return NewStore(&cfg, args)
+}
+
+// Load builds the configuration without side effects. Every field tagged as follows is read from,
+// in order of precedence:
+//
+//  1. args, command line flags named after the field, -DryRun=true
+//  2. env, environment variables named by the env tag, DRY_RUN=true
+//  3. the configuration file key named by the yaml tag, dry-run: true
+//  4. the default tag
+//
+// `ignored:"true" env:"ENVIRONMENT_VARIABLE" default:"default value" yaml:"file-key"`
+//
+// Fields marked ignored are not configurable. Outside the file, lists are written a,b,c, maps
+// k=v,k2=v2 and durations either 1m30s or a bare number of seconds. The configuration file is
+// read from fsys, the root of the file system, by the path of the ConfigFile setting; relative
+// paths are taken relative to the working directory. The result is validated, and the problems
+// found are returned as ValidationErrors. Problems that do not stop the configuration from being
+// used, such as a missing optional configuration file, are returned as warnings for the caller to
+// report.
+func Load(args []string, env func(string) (string, bool), fsys fs.FS) (Config, []string, error) {
 	cfg := DefaultConfig()
 
 	cfgInfo, err := getStructInfo(&cfg)
 	if err != nil {
-		log.Fatalf("[FATAL] %v", err)
+		return cfg, nil, err
+	}
+	flagSet := flag.NewFlagSet("config", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flags := registerFlags(flagSet, cfgInfo)
+	if err := flagSet.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+	if flagSet.NArg() > 0 {
+		return cfg, nil, fmt.Errorf("unexpected argument %q", flagSet.Arg(0))
 	}
 
-	for _, info := range cfgInfo {
-		switch info.Type.String() {
-		case "string":
-			var dv string
-			if info.DefaultValue != nil {
-				dv = info.DefaultValue.(string)
-			}
-			p := reflect.ValueOf(&cfg).Elem().FieldByName(info.Name).Addr().Interface().(*string)
-			flag.StringVar(p, info.Name, dv, "("+info.Key+")")
-
-		case "bool":
-			var dv bool
-			if info.DefaultValue != nil {
-				dv = info.DefaultValue.(bool)
-			}
-			p := reflect.ValueOf(&cfg).Elem().FieldByName(info.Name).Addr().Interface().(*bool)
-			flag.BoolVar(p, info.Name, dv, "("+info.Key+")")
+	if err := setDefaults(&cfg, cfgInfo); err != nil {
+		return cfg, nil, fmt.Errorf("setting defaults: %w", err)
+	}
 
-		case "int":
-			var dv int
-			if info.DefaultValue != nil {
-				dv = int(info.DefaultValue.(int64))
-			}
-			p := reflect.ValueOf(&cfg).Elem().FieldByName(info.Name).Addr().Interface().(*int)
-			flag.IntVar(p, info.Name, dv, "("+info.Key+")")
+	// read config file, whose location can only be set by a flag, the environment or the default.
+	// A missing file is only fatal when it is required.
+	if err := applyBeforeFile(&cfg, cfgInfo, flags, env); err != nil {
+		return cfg, nil, err
+	}
+	var (
+		warnings []string
+		fromFile [][]int
+	)
+	configFileData, err := getConfigFileData(fsys, cfg.ConfigFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !cfg.ConfigFileRequired:
+		warnings = append(warnings, fmt.Sprintf("configuration file %s not found, using the environment and defaults", cfg.ConfigFile))
+	case err != nil:
+		return cfg, nil, fmt.Errorf("reading configuration file %s: %w", cfg.ConfigFile, err)
+	default:
+		if fromFile, err = decodeFile(&cfg, configFileData); err != nil {
+			return cfg, nil, fmt.Errorf("configuration file %s: %w", cfg.ConfigFile, err)
 		}
 	}
-	flag.Parse()
 
-	// set logging level
-	setLogLevel(cfg)
+	// the environment overrides the file, and flags override both
+	if err := applyEnv(&cfg, cfgInfo, env); err != nil {
+		return cfg, nil, fmt.Errorf("environment variable %w", err)
+	}
+	if err := applyFlags(&cfg, flags); err != nil {
+		return cfg, nil, fmt.Errorf("command line flag %w", err)
+	}
+	cfg.sources = valueSources(cfgInfo, flags, env, fromFile)
+	if problems := readSecretFiles(&cfg, fsys); len(problems) > 0 {
+		return cfg, nil, ValidationErrors(problems)
+	}
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return cfg, nil, ValidationErrors(problems)
+	}
 
 	// timezone & format configuration
 	cfg.TZoneUTC, _ = time.LoadLocation("UTC")
-	if err != nil {
-		log.Fatalf("[ERROR] Unable to parse timezone string. Please use one of the timezone database values listed here: %s", "https://en.wikipedia.org/wiki/List_of_tz_database_time_zones")
-	}
 	cfg.TZoneLocal, err = time.LoadLocation(cfg.TimeZoneLocal)
 	if err != nil {
-		log.Fatalf("[ERROR] Unable to parse timezone string. Please use one of the timezone database values listed here: %s", "https://en.wikipedia.org/wiki/List_of_tz_database_time_zones")
+		return cfg, nil, fmt.Errorf("unable to parse timezone %q, please use one of the timezone database values listed here: https://en.wikipedia.org/wiki/List_of_tz_database_time_zones: %w", cfg.TimeZoneLocal, err)
 	}
-	time.Now().Format(cfg.TimeFormat)
 
-	// read config file
-	configFileData, err := getConfigFileData(cfg.ConfigFile)
-	if err != nil {
-		log.Fatalf("[FATAL] Unable to read configuration file: %v", err)
-	}
-	updateValues(&cfg, configFileData)
+	// compile namespace exclusions once so hooks can evaluate them per request without rebuilding
+	cfg.CompileExclusions()
 
-	// Generate certificates if needed
-	if err := certificateInit(&cfg); err != nil {
-		log.Fatalf("[FATAL] Unable to initialize certificate data: %v", err)
-	}
+	return cfg, warnings, nil
+}
 
-	// print running config
-	printRunningConfig(&cfg, cfgInfo)
+// fieldFlag is a command line flag for a configuration field. The value is only applied when the
+// flag was given, so flags take precedence without hiding the file and environment.
+type fieldFlag struct {
+	info  StructInfo
+	value string
+	set   bool
+}
 
-	log.Println("[INFO] initialization sequence complete")
-	return cfg
+func (f *fieldFlag) String() string {
+	return f.value
 }
 
-func updateValues(cfg *Config, configFileData configFileStruct) {
-	if cfg.AllowAdminNoMutate == false && configFileData.AllowAdminNoMutate != false {
-		cfg.AllowAdminNoMutate = configFileData.AllowAdminNoMutate
+func (f *fieldFlag) Set(value string) error {
+	if _, err := parseValue(f.info.Type, value); err != nil {
+		return err
 	}
-	if cfg.NameSpace == "openshift-webhook" && configFileData.Kubernetes.Namespace != "openshift-webhook" {
-		cfg.NameSpace = configFileData.Kubernetes.Namespace
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.info.Type.Kind() == reflect.Bool
+}
+
+// registerFlags defines a flag named after each configuration field.
+func registerFlags(fs *flag.FlagSet, cfgInfo []StructInfo) []*fieldFlag {
+	flags := make([]*fieldFlag, 0, len(cfgInfo))
+	for _, info := range cfgInfo {
+		f := &fieldFlag{info: info, value: info.Tags.Get("default")}
+		fs.Var(f, info.Name, "("+info.Key+")")
+		flags = append(flags, f)
 	}
-	if cfg.ServiceName == "custom-labels-webhook" && configFileData.Kubernetes.ServiceName != "custom-labels-webhook" {
-		cfg.ServiceName = configFileData.Kubernetes.ServiceName
+	return flags
+}
+
+// setDefaults sets every field to the value of its default tag.
+func setDefaults(spec interface{}, cfgInfo []StructInfo) error {
+	for _, info := range cfgInfo {
+		if info.DefaultValue == nil {
+			continue
+		}
+		if err := setField(spec, info, info.Tags.Get("default")); err != nil {
+			return err
+		}
 	}
-	if len(configFileData.ExcludedNamespaces) != 0 {
-		cfg.ExcludedNamespaces = configFileData.ExcludedNamespaces
+	return nil
+}
+
+// applyEnv sets every field whose environment variable is set.
+func applyEnv(spec interface{}, cfgInfo []StructInfo, lookup func(string) (string, bool)) error {
+	for _, info := range cfgInfo {
+		if info.Alt == "" {
+			continue
+		}
+		if value, ok := lookup(info.Alt); ok {
+			if err := setField(spec, info, value); err != nil {
+				return fmt.Errorf("%s: %w", info.Alt, err)
+			}
+		}
 	}
-	if len(configFileData.CustomLabels) != 0 {
-		cfg.CustomLabels = configFileData.CustomLabels
+	return nil
+}
+
+// applyFlags sets every field whose flag was given.
+func applyFlags(spec interface{}, flags []*fieldFlag) error {
+	for _, f := range flags {
+		if !f.set {
+			continue
+		}
+		if err := setField(spec, f.info, f.value); err != nil {
+			return fmt.Errorf("-%s: %w", f.info.Name, err)
+		}
 	}
-	if len(configFileData.CertificateAuthority.Certificate) != 0 {
-		cfg.CACert = configFileData.CertificateAuthority.Certificate
+	return nil
+}
+
+// beforeFile are the settings about the configuration file itself, which are needed before it is
+// read and so only come from flags, the environment and defaults.
+var beforeFile = []string{"ConfigFile", "ConfigFileRequired"}
+
+// applyBeforeFile sets the beforeFile settings from the environment and flags.
+func applyBeforeFile(cfg *Config, cfgInfo []StructInfo, flags []*fieldFlag, lookup func(string) (string, bool)) error {
+	var infos []StructInfo
+	var given []*fieldFlag
+	for _, name := range beforeFile {
+		for _, info := range cfgInfo {
+			if info.Name == name {
+				infos = append(infos, info)
+			}
+		}
+		for _, f := range flags {
+			if f.info.Name == name {
+				given = append(given, f)
+			}
+		}
 	}
-	if len(configFileData.CertificateAuthority.PrivateKey) != 0 {
-		cfg.CAPrivateKey = configFileData.CertificateAuthority.PrivateKey
+
+	if err := applyEnv(cfg, infos, lookup); err != nil {
+		return fmt.Errorf("environment variable %w", err)
 	}
-	if len(configFileData.Certificate.Certificate) != 0 {
-		cfg.CertCert = configFileData.Certificate.Certificate
+	if err := applyFlags(cfg, given); err != nil {
+		return fmt.Errorf("command line flag %w", err)
 	}
-	if len(configFileData.Certificate.PrivateKey) != 0 {
-		cfg.CertPrivateKey = configFileData.Certificate.PrivateKey
+	return nil
+}
+
+// setField converts the value to the type of the field and sets it.
+func setField(spec interface{}, info StructInfo, value string) error {
+	v, err := parseValue(info.Type, value)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, info.Name, err)
 	}
+	reflect.ValueOf(spec).Elem().FieldByIndex(info.Index).Set(v)
+	return nil
 }
 
 func certificateInit(cfg *Config) error {
 	// certificate authority private key does not exist, generate key pair
 	if len(cfg.CAPrivateKey) == 0 {
-		log.Printf("[TRACE] No certificate authority private key detected")
+		logging.Trace(context.Background(), "No certificate authority private key detected")
 		keyPair, err := certificate.CreateRSAKeyPair(4096)
 		if err != nil {
 			return fmt.Errorf("Create RSA Key (%v)", err)
@@ -139,21 +299,23 @@ func certificateInit(cfg *Config) error {
 			Bytes: x509.MarshalPKCS1PrivateKey(keyPair),
 		})
 		cfg.CAPrivateKey = k.String()
+		cfg.sources["CAPrivateKey"] = SourceGenerated
 	}
 
 	// certificate authority certificate is missing, create it
 	if len(cfg.CACert) == 0 {
-		log.Printf("[TRACE] No certificate authority certificate detected")
+		logging.Trace(context.Background(), "No certificate authority certificate detected")
 		caCert, err := certificate.CreateCA(cfg.CAPrivateKey)
 		if err != nil {
 			return fmt.Errorf("Create CA (%v)", err)
 		}
 		cfg.CACert = caCert
+		cfg.sources["CACert"] = SourceGenerated
 	}
 
 	// certificate private key does not exist, generate key pair
 	if len(cfg.CertPrivateKey) == 0 {
-		log.Printf("[TRACE] No server private key detected")
+		logging.Trace(context.Background(), "No server private key detected")
 		keyPair, err := certificate.CreateRSAKeyPair(4096)
 		if err != nil {
 			return fmt.Errorf("Create RSA Key (%v)", err)
@@ -165,12 +327,13 @@ func certificateInit(cfg *Config) error {
 			Bytes: x509.MarshalPKCS1PrivateKey(keyPair),
 		})
 		cfg.CertPrivateKey = k.String()
+		cfg.sources["CertPrivateKey"] = SourceGenerated
 	}
 
 	// certificate certificate is missing, create it
 	if len(cfg.CertCert) == 0 {
-		log.Printf("[TRACE] No server certificate detected")
-		csr, err := certificate.CreateCSR(cfg.CertPrivateKey, getDNSNames(cfg.ServiceName, cfg.NameSpace,))
+		logging.Trace(context.Background(), "No server certificate detected")
+		csr, err := certificate.CreateCSR(cfg.CertPrivateKey, getDNSNames(cfg.ServiceName, cfg.NameSpace))
 		if err != nil {
 			return fmt.Errorf("Create CSR (%v)", err)
 		}
@@ -179,6 +342,7 @@ func certificateInit(cfg *Config) error {
 			return fmt.Errorf("Sign Cert (%v)", err)
 		}
 		cfg.CertCert = cert
+		cfg.sources["CertCert"] = SourceGenerated
 	}
 
 	return nil
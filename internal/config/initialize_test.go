@@ -1,19 +1,16 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
-/*
-func TestInit(t *testing.T) {
-	cfg := Init()
-	if cfg.AllowAdminNoMutateToggle != "7b068a99-c02b-410a-bd59-3514bac85e7a" {
-		t.Errorf("Init() returned incorrect value for AllowAdminNoMutateToggle, got %v, wanted %v", cfg.AllowAdminNoMutateToggle, "7b068a99-c02b-410a-bd59-3514bac85e7a")
-	}
-}
-*/
-
 func TestGetOSEnv(t *testing.T) {
 	expected := "foo"
 	os.Setenv("TEST_ENV", expected)
@@ -30,70 +27,204 @@ func TestGetOSEnv(t *testing.T) {
 	}
 }
 
-func TestUpdateValues(t *testing.T) {
-	cfg := Config{
-		AllowAdminNoMutate:       false,
-		AllowAdminNoMutateToggle: "7b068a99-c02b-410a-bd59-3514bac85e7a",
-		DockerhubRegistry:        "registry.hub.docker.com",
-		NameSpace:                "ingress-nginx",
-		ServiceName:              "webhook",
-		MutateIgnoredImages: []string{
-			"example.com/library/example:v2.3.4",
-		},
-	}
-	cfgFile := configFileStruct{
-		AllowAdminNoMutate:       true,
-		AllowAdminNoMutateToggle: "test-token",
-		DockerhubRegistry:        "registry.example.com",
-		Kubernetes: KubernetesStruct{
-			Namespace:   "example-namespace",
-			ServiceName: "example-webhook",
-		},
-		MutateIgnoredImages: []string{
-			"example.com/library/example:latest",
-			"example.com/library/example:v1.2.3",
-		},
+func TestApplyConfigFile(t *testing.T) {
+	data := []byte(`
+allow-admin-nomutate: true
+dry-run: true
+enable-labeling: false
+hook-timeout: 3
+excluded-namespaces:
+  - default
+  - legacy-system
+failure-policies:
+  pod-mutation: Fail
+kubernetes:
+  namespace: example-namespace
+  service-name: example-webhook
+`)
+
+	cfg := Config{EnableLabeling: true}
+	if err := applyConfigFile(&cfg, data); err != nil {
+		t.Fatalf("applyConfigFile() returned an error: %v", err)
 	}
 
-	updateValues(&cfg, cfgFile)
-	if cfg.AllowAdminNoMutate != cfgFile.AllowAdminNoMutate {
-		t.Errorf("updateValues() returned incorrect value for AllowAdminNoMutate, got %v, wanted %v", cfg.AllowAdminNoMutate, cfgFile.AllowAdminNoMutate)
+	if !cfg.AllowAdminNoMutate || !cfg.DryRun || cfg.EnableLabeling || cfg.HookTimeout != 3*time.Second {
+		t.Errorf("applyConfigFile() returned incorrect values, got AllowAdminNoMutate %v, DryRun %v, EnableLabeling %v, HookTimeout %v",
+			cfg.AllowAdminNoMutate, cfg.DryRun, cfg.EnableLabeling, cfg.HookTimeout)
 	}
-	if cfg.AllowAdminNoMutateToggle != cfgFile.AllowAdminNoMutateToggle {
-		t.Errorf("updateValues() returned incorrect value for AllowAdminNoMutateToken, got %v, wanted %v", cfg.AllowAdminNoMutateToggle, cfgFile.AllowAdminNoMutateToggle)
+	if cfg.NameSpace != "example-namespace" || cfg.ServiceName != "example-webhook" {
+		t.Errorf("applyConfigFile() returned incorrect kubernetes values, got %v and %v", cfg.NameSpace, cfg.ServiceName)
 	}
-	if cfg.DockerhubRegistry != cfgFile.DockerhubRegistry {
-		t.Errorf("updateValues() returned incorrect value for DockerhubRegistry, got %v, wanted %v", cfg.DockerhubRegistry, cfgFile.DockerhubRegistry)
+	if !reflect.DeepEqual(cfg.ExcludedNamespaces, []string{"default", "legacy-system"}) {
+		t.Errorf("applyConfigFile() returned incorrect value for ExcludedNamespaces, got %v", cfg.ExcludedNamespaces)
 	}
-	if cfg.NameSpace != cfgFile.Kubernetes.Namespace {
-		t.Errorf("updateValues() returned incorrect value for NameSpace, got %v, wanted %v", cfg.NameSpace, cfgFile.Kubernetes.Namespace)
+	if cfg.FailurePolicies["pod-mutation"] != FailurePolicyFail {
+		t.Errorf("applyConfigFile() returned incorrect value for FailurePolicies, got %v", cfg.FailurePolicies)
 	}
-	if cfg.ServiceName != cfgFile.Kubernetes.ServiceName {
-		t.Errorf("updateValues() returned incorrect value for ServiceName, got %v, wanted %v", cfg.ServiceName, cfgFile.Kubernetes.ServiceName)
+}
+
+func TestApplyConfigFileUnknownKeys(t *testing.T) {
+	tests := map[string]string{
+		"dry-runn: true\n":                   `unknown key "dry-runn"`,
+		"kubernetes:\n  name-space: other\n": `unknown key "name-space"`,
+		"hook-timeout: soon\n":               `invalid duration "soon"`,
+		"excluded-namespaces: default\n":     "cannot unmarshal",
 	}
-	if len(cfg.MutateIgnoredImages) != len(cfgFile.MutateIgnoredImages) {
-		t.Errorf("updateValues() returned incorrect value for MutateIgnoredImages, got %v records, wanted %v", len(cfg.MutateIgnoredImages), len(cfgFile.MutateIgnoredImages))
-	} else {
-		for k := range cfg.MutateIgnoredImages {
-			if cfg.MutateIgnoredImages[k] != cfgFile.MutateIgnoredImages[k] {
-				t.Errorf("updateValues() returned incorrect value for MutateIgnoredImages, got %v, wanted %v", cfg.MutateIgnoredImages[k], cfgFile.MutateIgnoredImages[k])
-			}
+
+	for data, want := range tests {
+		cfg := Config{}
+		err := applyConfigFile(&cfg, []byte(data))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("applyConfigFile(%q) returned incorrect error, got %v, wanted %q", data, err, want)
 		}
 	}
-	/*
-		if len(configFileData.CertificateAuthority.Certificate) != 0 {
-			cfg.CACert = configFileData.CertificateAuthority.Certificate
+}
+
+func TestShippedConfigFiles(t *testing.T) {
+	files := []string{
+		"../../config.yaml",
+		"../../k8s/overlays/sandbox/config.yaml",
+		"../../k8s/overlays/production/config.yaml",
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
 		}
-		if len(configFileData.CertificateAuthority.PrivateKey) != 0 {
-			cfg.CAPrivateKey = configFileData.CertificateAuthority.PrivateKey
+		cfg := Config{}
+		if err := applyConfigFile(&cfg, data); err != nil {
+			t.Errorf("applyConfigFile(%s) returned an error: %v", file, err)
 		}
-		if len(configFileData.Certificate.Certificate) != 0 {
-			cfg.CertCert = configFileData.Certificate.Certificate
+		if problems := ValidateFile(file); len(problems) > 0 {
+			t.Errorf("ValidateFile(%s) returned problems: %v", file, problems)
+		}
+	}
+}
+
+// TestPrecedence checks that flags override the environment, which overrides the configuration
+// file, which overrides the defaults.
+func TestPrecedence(t *testing.T) {
+	args := []string{"-LabelPrefix=flag", "-DryRun"}
+	env := map[string]string{
+		"CONFIG_FILE":  "/config.yaml",
+		"LABEL_PREFIX": "env",
+		"ORGANIZATION": "env",
+		"DRY_RUN":      "false",
+	}
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("label-prefix: file\norganization: file\nenvironment: file\n")},
+	}
+
+	cfg, _, err := Load(args, func(key string) (string, bool) { v, ok := env[key]; return v, ok }, fsys)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name, got, want string
+	}{
+		{"LabelPrefix", cfg.LabelPrefix, "flag"},
+		{"Organization", cfg.Organization, "env"},
+		{"Environment", cfg.Environment, "file"},
+		{"ClusterName", cfg.ClusterName, "openshift-cluster"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s has incorrect value, got %v, wanted %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if !cfg.DryRun {
+		t.Errorf("DryRun has incorrect value, got %v, wanted the flag value true", cfg.DryRun)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+	fsys := fstest.MapFS{
+		"etc/webhook/config.yaml": {Data: []byte("excluded-namespaces: [legacy]\n")},
+		"invalid.yaml":            {Data: []byte("label-prefix: Not_A_Domain\nwebserver-port: 0\n")},
+	}
+
+	// the file location can be set by a flag
+	cfg, _, err := Load([]string{"-ConfigFile=/etc/webhook/config.yaml"}, noEnv, fsys)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if !cfg.IsNamespaceExcluded("legacy") || cfg.TZoneLocal == nil {
+		t.Errorf("Load() did not finish the configuration, got ExcludedNamespaces %v, TZoneLocal %v", cfg.ExcludedNamespaces, cfg.TZoneLocal)
+	}
+	if cfg.CACert != "" {
+		t.Errorf("Load() generated certificates")
+	}
+
+	// every problem is returned at once
+	_, _, err = Load([]string{"-ConfigFile=/invalid.yaml"}, noEnv, fsys)
+	var problems ValidationErrors
+	if !errors.As(err, &problems) || len(problems) != 2 {
+		t.Errorf("Load() of an invalid file returned incorrect error, got %v, wanted 2 problems", err)
+	}
+
+	for _, args := range [][]string{{"-NoSuchFlag"}, {"-WebServerPort=http"}, {"extra"}} {
+		if _, _, err := Load(args, noEnv, fsys); err == nil {
+			t.Errorf("Load(%v) returned no error", args)
 		}
-		if len(configFileData.Certificate.PrivateKey) != 0 {
-			cfg.CertPrivateKey = configFileData.Certificate.PrivateKey
+	}
+}
+
+func TestLoadMissingConfigFile(t *testing.T) {
+	env := map[string]string{
+		"CONFIG_FILE":  "missing.yaml",
+		"LABEL_PREFIX": "example.com",
+	}
+	lookup := func(key string) (string, bool) { v, ok := env[key]; return v, ok }
+
+	cfg, warnings, err := Load(nil, lookup, fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("load() without a configuration file returned an error: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing.yaml") {
+		t.Errorf("load() returned incorrect warnings, got %v", warnings)
+	}
+	if cfg.LabelPrefix != "example.com" || cfg.Organization != "default" {
+		t.Errorf("load() returned incorrect values, got LabelPrefix %v, Organization %v", cfg.LabelPrefix, cfg.Organization)
+	}
+
+	env["CONFIG_FILE_REQUIRED"] = "true"
+	if _, _, err := Load(nil, lookup, fstest.MapFS{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("load() of a required configuration file returned incorrect error, got %v, wanted %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestIsNamespaceExcluded(t *testing.T) {
+	cfg := Config{
+		NameSpace:          "webhook-system",
+		ExcludedNamespaces: []string{"legacy-system"},
+	}
+	cfg.CompileExclusions()
+
+	tests := map[string]bool{
+		"kube-system":          true,
+		"openshift-monitoring": true,
+		"legacy-system":        true,
+		"webhook-system":       true,
+		"team-a":               false,
+		"":                     false,
+	}
+	for ns, expected := range tests {
+		if result := cfg.IsNamespaceExcluded(ns); result != expected {
+			t.Errorf("IsNamespaceExcluded(%q) returned incorrect value, got %v, wanted %v", ns, result, expected)
 		}
-	*/
+	}
+
+	// a configuration that was never compiled must still honor the exclusion lists
+	uncompiled := Config{ExcludedNamespaces: []string{"legacy-system"}}
+	if !uncompiled.IsNamespaceExcluded("legacy-system") || !uncompiled.IsNamespaceExcluded("kube-system") {
+		t.Errorf("IsNamespaceExcluded() on an uncompiled configuration did not honor the exclusion lists")
+	}
+	var zero Config
+	if !zero.IsNamespaceExcluded("openshift-webhook") || zero.IsNamespaceExcluded("team-a") {
+		t.Errorf("IsNamespaceExcluded() on a zero configuration returned incorrect value")
+	}
 }
 
 func TestGetDNSNames(t *testing.T) {
@@ -112,3 +243,19 @@ func TestGetDNSNames(t *testing.T) {
 	}
 	return
 }
+
+func TestFailurePolicyFor(t *testing.T) {
+	cfg := Config{
+		FailurePolicy: FailurePolicyIgnore,
+		FailurePolicies: map[string]string{
+			"pod-validation": FailurePolicyFail,
+		},
+	}
+
+	if cfg.FailsClosed("pod-mutation") {
+		t.Errorf("FailsClosed() returned true for a hook without an override, wanted the default %s", FailurePolicyIgnore)
+	}
+	if !cfg.FailsClosed("pod-validation") {
+		t.Errorf("FailsClosed() returned false for a hook configured with %s", FailurePolicyFail)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import "slices"
+
+// systemNamespaces are always excluded from admission processing, in addition to
+// the namespaces listed in the configuration file.
+var systemNamespaces = []string{
+	"kube-system",
+	"kube-public",
+	"kube-node-lease",
+	"openshift-system",
+	"openshift-kube-apiserver",
+	"openshift-kube-scheduler",
+	"openshift-kube-controller-manager",
+	"openshift-etcd",
+	"openshift-apiserver",
+	"openshift-controller-manager",
+	"openshift-authentication",
+	"openshift-oauth-apiserver",
+	"openshift-service-ca",
+	"openshift-network-operator",
+	"openshift-cluster-machine-approver",
+	"openshift-cluster-samples-operator",
+	"openshift-cluster-storage-operator",
+	"openshift-cluster-version",
+	"openshift-config",
+	"openshift-config-managed",
+	"openshift-console",
+	"openshift-console-operator",
+	"openshift-dns",
+	"openshift-dns-operator",
+	"openshift-image-registry",
+	"openshift-ingress",
+	"openshift-ingress-operator",
+	"openshift-machine-api",
+	"openshift-machine-config-operator",
+	"openshift-monitoring",
+	"openshift-multus",
+	"openshift-node",
+	"openshift-operator-lifecycle-manager",
+	"openshift-operators",
+	"openshift-ovn-kubernetes",
+	"openshift-sdn",
+	"openshift-user-workload-monitoring",
+	"openshift-webhook",
+}
+
+// NamespaceSet is a set of namespace names used for constant time lookups.
+type NamespaceSet map[string]struct{}
+
+// NewNamespaceSet builds a set from one or more lists of namespace names. Empty names are skipped.
+func NewNamespaceSet(lists ...[]string) NamespaceSet {
+	set := make(NamespaceSet)
+	for _, list := range lists {
+		for _, ns := range list {
+			if ns != "" {
+				set[ns] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+// Has reports whether the namespace is a member of the set.
+func (s NamespaceSet) Has(namespace string) bool {
+	_, ok := s[namespace]
+	return ok
+}
+
+// CompileExclusions builds the excluded namespace set from the system namespaces, the configured
+// exclusion list and the namespace the webhook itself runs in. It must be called after all
+// configuration sources have been applied.
+func (c *Config) CompileExclusions() {
+	c.ExcludedNamespaceSet = NewNamespaceSet(systemNamespaces, c.ExcludedNamespaces, []string{c.NameSpace})
+}
+
+// IsNamespaceExcluded reports whether requests in the namespace should be skipped by every hook.
+// Cluster scoped requests (empty namespace) are never excluded. The set is built once by
+// CompileExclusions; a Config that was never compiled, such as the zero value, checks the same lists
+// directly so system namespaces are still skipped.
+func (c *Config) IsNamespaceExcluded(namespace string) bool {
+	if namespace == "" {
+		return false
+	}
+	if c.ExcludedNamespaceSet == nil {
+		return slices.Contains(systemNamespaces, namespace) || slices.Contains(c.ExcludedNamespaces, namespace) || namespace == c.NameSpace
+	}
+	return c.ExcludedNamespaceSet.Has(namespace)
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Store holds the current configuration. Readers take a snapshot with Load and keep using it for
+// the rest of their work, so a reload never changes the configuration halfway through a request.
+type Store struct {
+	current atomic.Pointer[Config]
+
+	// args are the configuration flags given at startup, which apply to every reload
+	args []string
+
+	// version identifies the configuration and secret files the Store was created from, see Watch
+	version string
+}
+
+// NewStore returns a Store holding cfg, which was loaded with the configuration flags args.
+func NewStore(cfg *Config, args []string) *Store {
+	s := &Store{args: args}
+	s.current.Store(cfg)
+	s.version = filesVersion(watchedFiles(cfg))
+	return s
+}
+
+// Load returns the current configuration, which must not be modified.
+func (s *Store) Load() *Config {
+	return s.current.Load()
+}
+
+// Reload reads the configuration file again, together with the environment and the command line
+// flags given at startup, and swaps it in. Settings tagged reload:"false" are only read at startup
+// and keep their current value, except certificates and keys read from a file, which are applied so
+// a rotated Secret takes effect. When the configuration is invalid the current one is kept and the
+// error returned.
+func (s *Store) Reload() error {
+	prev := s.Load()
+	cfg, warnings, err := Load(s.args, os.LookupEnv, HostFS)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		slog.Warn("Configuration warning", "warning", warning)
+	}
+
+	for _, name := range keepStartupSettings(&cfg, prev) {
+		slog.Warn("Configuration setting changed but is only applied on restart", "setting", name)
+	}
+	cfg.CompileExclusions()
+
+	s.current.Store(&cfg)
+	return nil
+}
+
+// keepStartupSettings copies the settings tagged reload:"false" from prev into cfg, other than the
+// secrets read again from their file, and returns the names of those whose new value was set and
+// differs from prev.
+func keepStartupSettings(cfg, prev *Config) []string {
+	var changed []string
+	reread := rereadSecrets(cfg, prev)
+	next, current := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(prev).Elem()
+	for i := 0; i < next.NumField(); i++ {
+		name := next.Type().Field(i).Name
+		if next.Type().Field(i).Tag.Get("reload") != "false" || reread[name] {
+			continue
+		}
+		if !next.Field(i).IsZero() && !reflect.DeepEqual(next.Field(i).Interface(), current.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+		next.Field(i).Set(current.Field(i))
+		cfg.sources[name] = prev.Source(name)
+	}
+	return changed
+}
+
+// Watch polls the configuration file and the certificate and key files every interval and reloads
+// the Store when any of them differs from the files the Store was created from, until ctx is
+// cancelled. The outcome of every reload is passed to done. A file mounted from a ConfigMap or
+// Secret is a symlink the kubelet swaps to a new directory on update, so the files are compared by
+// the target of the symlink as well as their size and modification time. Watch must be called at
+// most once.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, done func(error)) {
+	paths, last := watchedFiles(s.Load()), s.version
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		version := filesVersion(paths)
+		if version == last {
+			continue
+		}
+		last = version
+		done(s.Reload())
+	}
+}
+
+// watchedFiles returns the files cfg was read from: the configuration file and the files of the
+// certificates and keys. Their paths are only read at startup.
+func watchedFiles(cfg *Config) []string {
+	paths := []string{cfg.ConfigFile}
+	for _, secret := range cfg.secretFiles() {
+		if secret.path != "" {
+			paths = append(paths, secret.path)
+		}
+	}
+	return paths
+}
+
+// filesVersion identifies the content of the files at paths, see fileVersion. A file that cannot be
+// found counts as empty, so creating it is a change.
+func filesVersion(paths []string) string {
+	versions := make([]string, len(paths))
+	for i, path := range paths {
+		versions[i], _ = fileVersion(path)
+	}
+	return strings.Join(versions, "\n")
+}
+
+// fileVersion identifies the content of the file at path without reading it.
+func fileVersion(path string) (string, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %d %d", target, info.Size(), info.ModTime().UnixNano()), nil
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfigMap lays out dir like a ConfigMap volume: config.yaml links to ..data/config.yaml and
+// ..data links to a timestamped directory, which is swapped on every update.
+func writeConfigMap(t *testing.T, dir, version, content string) {
+	t.Helper()
+	data := filepath.Join(dir, "..2024_"+version)
+	if err := os.Mkdir(data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "config.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(data), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "config.yaml")); os.IsNotExist(err) {
+		if err := os.Symlink("..data/config.yaml", filepath.Join(dir, "config.yaml")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestStore(t *testing.T, content string) (*Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "1", content)
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "config.yaml"))
+
+	cfg, _, err := Load(nil, os.LookupEnv, HostFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(&cfg, nil), dir
+}
+
+func TestStoreReload(t *testing.T) {
+	store, dir := newTestStore(t, "excluded-namespaces: [legacy]\nwebserver-port: 8443\n")
+	before := store.Load()
+
+	writeConfigMap(t, dir, "2", "excluded-namespaces: [sandbox]\nwebserver-port: 9443\n")
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() returned an error: %v", err)
+	}
+
+	after := store.Load()
+	if !after.IsNamespaceExcluded("sandbox") || after.IsNamespaceExcluded("legacy") {
+		t.Errorf("Reload() did not apply the new excluded namespaces, got %v", after.ExcludedNamespaces)
+	}
+	if after.WebServerPort != 8443 {
+		t.Errorf("Reload() changed a setting only read at startup, got WebServerPort %d, wanted 8443", after.WebServerPort)
+	}
+	if !before.IsNamespaceExcluded("legacy") {
+		t.Errorf("Reload() modified the previous configuration")
+	}
+
+	// an invalid file keeps the last good configuration
+	writeConfigMap(t, dir, "3", "excluded-namespace: [typo]\n")
+	if err := store.Reload(); err == nil {
+		t.Errorf("Reload() of an invalid file returned no error")
+	}
+	if store.Load() != after {
+		t.Errorf("Reload() of an invalid file replaced the configuration")
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	store, dir := newTestStore(t, "label-prefix: before\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go store.Watch(ctx, 10*time.Millisecond, func(err error) { done <- err })
+
+	writeConfigMap(t, dir, "2", "label-prefix: after\n")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Watch() reported an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not reload the swapped file")
+	}
+
+	if prefix := store.Load().LabelPrefix; prefix != "after" {
+		t.Errorf("Watch() returned incorrect value, got %v, wanted %v", prefix, "after")
+	}
+}
+
+func TestStoreReloadKeepsFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "1", "dry-run: false\n")
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "config.yaml"))
+
+	args := []string{"-DryRun=true"}
+	cfg, _, err := Load(args, os.LookupEnv, HostFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(&cfg, args)
+
+	writeConfigMap(t, dir, "2", "dry-run: false\nlabel-prefix: after\n")
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() returned an error: %v", err)
+	}
+	if after := store.Load(); !after.DryRun || after.LabelPrefix != "after" {
+		t.Errorf("Reload() returned incorrect value, got DryRun %v, LabelPrefix %v, wanted true, after", after.DryRun, after.LabelPrefix)
+	}
+}
+
+func TestStoreReloadSecretFiles(t *testing.T) {
+	key := func(content string) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte(content)})
+	}
+	secrets := filepath.Join(t.TempDir(), "server.key")
+	if err := os.WriteFile(secrets, key("before"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CERT_PRIVATE_KEY_FILE", secrets)
+	store, _ := newTestStore(t, "label-prefix: before\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go store.Watch(ctx, 10*time.Millisecond, func(err error) { done <- err })
+
+	// a rotated key is applied without touching the configuration file
+	if err := os.WriteFile(secrets, key("after-rotation"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Watch() reported an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not reload the rotated key")
+	}
+
+	if got := store.Load().CertPrivateKey; got != string(key("after-rotation")) {
+		t.Errorf("Watch() returned incorrect value, got %q, wanted %q", got, key("after-rotation"))
+	}
+}
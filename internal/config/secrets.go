@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// secretFile is a setting whose value can also be read from a file, such as a key mounted from a
+// Secret, so it does not have to be passed in the environment or the configuration file.
+type secretFile struct {
+	key   string
+	name  string
+	value *string
+	path  string
+}
+
+func (c *Config) secretFiles() []secretFile {
+	return []secretFile{
+		{"certificate-authority.certificate", "CACert", &c.CACert, c.CACertFile},
+		{"certificate-authority.private-key", "CAPrivateKey", &c.CAPrivateKey, c.CAPrivateKeyFile},
+		{"certificate.certificate", "CertCert", &c.CertCert, c.CertCertFile},
+		{"certificate.private-key", "CertPrivateKey", &c.CertPrivateKey, c.CertPrivateKeyFile},
+	}
+}
+
+// readSecretFiles sets every setting that has a file configured to the content of that file, and
+// returns every problem found. A setting given both inline and as a file is rejected rather than
+// silently preferring one of them. The setting reports the source of its file path.
+func readSecretFiles(cfg *Config, fsys fs.FS) []error {
+	var errs []error
+	for _, secret := range cfg.secretFiles() {
+		if secret.path == "" {
+			continue
+		}
+		if *secret.value != "" {
+			errs = append(errs, fmt.Errorf("%s: set either %s or %s-file, not both", secret.key, secret.key, secret.key))
+			continue
+		}
+		data, err := getConfigFileData(fsys, secret.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s-file: %w", secret.key, err))
+			continue
+		}
+		*secret.value = string(data)
+		cfg.sources[secret.name] = cfg.Source(secret.name + "File")
+	}
+	return errs
+}
+
+// rereadSecrets returns the names of the settings cfg read from the same file as prev. A reload
+// applies their new content, while a changed file path is only applied on restart.
+func rereadSecrets(cfg, prev *Config) map[string]bool {
+	reread := map[string]bool{}
+	previous := prev.secretFiles()
+	for i, secret := range cfg.secretFiles() {
+		if secret.path != "" && secret.path == previous[i].path {
+			reread[secret.name] = true
+		}
+	}
+	return reread
+}
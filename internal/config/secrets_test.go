@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/pem"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadSecretFiles(t *testing.T) {
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key")}))
+	fsys := fstest.MapFS{
+		"config.yaml":        {Data: []byte("certificate-authority:\n  private-key-file: /secrets/ca.key\n")},
+		"secrets/ca.key":     {Data: []byte(key)},
+		"secrets/server.key": {Data: []byte(key)},
+	}
+	env := map[string]string{
+		"CONFIG_FILE":           "/config.yaml",
+		"CERT_PRIVATE_KEY_FILE": "/secrets/server.key",
+	}
+	lookup := func(key string) (string, bool) { v, ok := env[key]; return v, ok }
+
+	cfg, _, err := Load(nil, lookup, fsys)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg.CAPrivateKey != key || cfg.Source("CAPrivateKey") != SourceFile {
+		t.Errorf("Load() returned incorrect value for CAPrivateKey, got %q from %s", cfg.CAPrivateKey, cfg.Source("CAPrivateKey"))
+	}
+	if cfg.CertPrivateKey != key || cfg.Source("CertPrivateKey") != SourceEnv {
+		t.Errorf("Load() returned incorrect value for CertPrivateKey, got %q from %s", cfg.CertPrivateKey, cfg.Source("CertPrivateKey"))
+	}
+
+	tests := map[string]string{
+		"CERT_PRIVATE_KEY": "certificate.private-key: set either",
+		"":                 "certificate.private-key-file: open secrets/missing.key",
+	}
+	for name, want := range tests {
+		env := map[string]string{"CERT_PRIVATE_KEY_FILE": "/secrets/missing.key"}
+		if name != "" {
+			env["CERT_PRIVATE_KEY_FILE"] = "/secrets/server.key"
+			env[name] = key
+		}
+		_, _, err := Load(nil, func(key string) (string, bool) { v, ok := env[key]; return v, ok }, fsys)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() returned incorrect error, got %v, wanted %q", err, want)
+		}
+	}
+}
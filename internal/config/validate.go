@@ -0,0 +1,200 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"mutating-webhook/internal/logging"
+)
+
+// Validate checks the configuration and returns every problem found, so all of them can be fixed
+// at once. Problems name the configuration file key of the setting.
+func (c *Config) Validate() []error {
+	var errs []error
+	add := func(key string, value interface{}, problems ...string) {
+		for _, problem := range problems {
+			errs = append(errs, fmt.Errorf("%s %q: %s", key, fmt.Sprint(value), problem))
+		}
+	}
+
+	// logging and time
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		add("log-level", c.LogLevel, err.Error())
+	}
+	if f := strings.ToLower(c.LogFormat); f != "" && f != logging.FormatText && f != logging.FormatJSON {
+		add("log-format", c.LogFormat, fmt.Sprintf("must be %s or %s", logging.FormatText, logging.FormatJSON))
+	}
+	if _, err := time.LoadLocation(c.TimeZoneLocal); err != nil {
+		add("time-zone", c.TimeZoneLocal, "must be a timezone database name such as Europe/Amsterdam")
+	}
+
+	// listeners
+	add("webserver-port", c.WebServerPort, validation.IsValidPortNum(c.WebServerPort)...)
+	if c.EnableMetrics {
+		add("metrics-port", c.MetricsPort, validation.IsValidPortNum(c.MetricsPort)...)
+		if c.MetricsPort == c.WebServerPort {
+			add("metrics-port", c.MetricsPort, "must differ from webserver-port")
+		}
+	}
+	if c.WebServerIP != "" {
+		add("webserver-ip", c.WebServerIP, validation.IsValidIP(c.WebServerIP)...)
+	}
+	if c.AdminPort != 0 {
+		add("admin-port", c.AdminPort, validation.IsValidPortNum(c.AdminPort)...)
+		if c.AdminPort == c.WebServerPort || (c.EnableMetrics && c.AdminPort == c.MetricsPort) {
+			add("admin-port", c.AdminPort, "must differ from webserver-port and metrics-port")
+		}
+	}
+	if c.AdminIP != "" {
+		add("admin-ip", c.AdminIP, validation.IsValidIP(c.AdminIP)...)
+	}
+	if c.AdminAuth != AdminAuthStatic && c.AdminAuth != AdminAuthTokenReview {
+		add("admin-auth", c.AdminAuth, fmt.Sprintf("must be %s or %s", AdminAuthStatic, AdminAuthTokenReview))
+	}
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"webserver-read-timeout", c.WebServerReadTimeout},
+		{"webserver-write-timeout", c.WebServerWriteTimeout},
+		{"webserver-idle-timeout", c.WebServerIdleTimeout},
+		{"hook-timeout", c.HookTimeout},
+		{"event-interval", c.EventInterval},
+		{"backfill-interval", c.BackfillInterval},
+		{"config-reload-interval", c.ConfigReloadInterval},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			add(d.key, d.value, "must not be negative")
+		}
+	}
+
+	// admission control
+	add("label-prefix", c.LabelPrefix, validation.IsDNS1123Subdomain(c.LabelPrefix)...)
+	if len(validation.IsDNS1123Subdomain(c.LabelPrefix)) == 0 {
+		add("label-prefix", c.LabelPrefix, validation.IsQualifiedName(c.AppIDLabel())...)
+	}
+	for _, key := range sortedKeys(c.CustomLabels) {
+		add("custom-labels", key, validation.IsQualifiedName(key)...)
+		add("custom-labels."+key, c.CustomLabels[key], validation.IsValidLabelValue(c.CustomLabels[key])...)
+	}
+	for _, ns := range c.ExcludedNamespaces {
+		add("excluded-namespaces", ns, validation.IsDNS1123Label(ns)...)
+	}
+	if !validFailurePolicy(c.FailurePolicy) {
+		add("failure-policy", c.FailurePolicy, fmt.Sprintf("must be %s or %s", FailurePolicyIgnore, FailurePolicyFail))
+	}
+	for _, hook := range sortedKeys(c.FailurePolicies) {
+		if !validFailurePolicy(c.FailurePolicies[hook]) {
+			add("failure-policies."+hook, c.FailurePolicies[hook], fmt.Sprintf("must be %s or %s", FailurePolicyIgnore, FailurePolicyFail))
+		}
+	}
+	switch c.AppIDChangePolicy {
+	case AppIDChangeIgnore, AppIDChangeFlag, AppIDChangeRelabel:
+	default:
+		add("appid-change-policy", c.AppIDChangePolicy, fmt.Sprintf("must be %s, %s or %s", AppIDChangeIgnore, AppIDChangeFlag, AppIDChangeRelabel))
+	}
+
+	// background work
+	if c.AuditQueueSize <= 0 {
+		add("audit-queue-size", c.AuditQueueSize, "must be greater than zero")
+	}
+	if c.BackfillQPS <= 0 {
+		add("backfill-qps", c.BackfillQPS, "must be greater than zero")
+	}
+	if c.BackfillBurst <= 0 {
+		add("backfill-burst", c.BackfillBurst, "must be greater than zero")
+	}
+	if _, err := labels.Parse(c.BackfillSelector); err != nil {
+		add("backfill-selector", c.BackfillSelector, err.Error())
+	}
+
+	// certificates, which are generated at startup when left empty
+	errs = append(errs, validateKeyPair("certificate-authority", c.CACert, c.CAPrivateKey)...)
+	errs = append(errs, validateKeyPair("certificate", c.CertCert, c.CertPrivateKey)...)
+
+	return errs
+}
+
+func validFailurePolicy(policy string) bool {
+	return policy == FailurePolicyIgnore || policy == FailurePolicyFail
+}
+
+// validateKeyPair checks that the PEM certificate and private key of a section parse and, when both
+// are set, belong together.
+func validateKeyPair(section, cert, key string) []error {
+	var errs []error
+	if cert != "" {
+		block, _ := pem.Decode([]byte(cert))
+		if block == nil || block.Type != "CERTIFICATE" {
+			errs = append(errs, fmt.Errorf("%s.certificate: must be a PEM encoded certificate", section))
+		} else if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			errs = append(errs, fmt.Errorf("%s.certificate: %w", section, err))
+		}
+	}
+	if key != "" {
+		if block, _ := pem.Decode([]byte(key)); block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			errs = append(errs, fmt.Errorf("%s.private-key: must be a PEM encoded private key", section))
+		}
+	}
+	if cert != "" && key != "" && len(errs) == 0 {
+		if _, err := tls.X509KeyPair([]byte(cert), []byte(key)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: certificate and private-key do not match: %w", section, err))
+		}
+	}
+	return errs
+}
+
+// ValidateFile loads the configuration file at path over the defaults, ignoring the environment
+// and command line flags, and returns every problem with it.
+func ValidateFile(path string) []error {
+	cfg := DefaultConfig()
+	cfgInfo, err := getStructInfo(&cfg)
+	if err != nil {
+		return []error{err}
+	}
+	if err := setDefaults(&cfg, cfgInfo); err != nil {
+		return []error{err}
+	}
+
+	data, err := getConfigFileData(HostFS, path)
+	if err != nil {
+		return []error{err}
+	}
+	if err := applyConfigFile(&cfg, data); err != nil {
+		return []error{err}
+	}
+
+	// certificates and keys named by *-file settings are read like Load does
+	cfg.sources = make(map[string]Source)
+	problems := readSecretFiles(&cfg, HostFS)
+	return append(problems, cfg.Validate()...)
+}
+
+// ValidationErrors are the problems found by Validate.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
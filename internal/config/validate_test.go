@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func defaultConfig(t *testing.T) Config {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfgInfo, err := getStructInfo(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setDefaults(&cfg, cfgInfo); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	cfg := defaultConfig(t)
+	if problems := cfg.Validate(); len(problems) > 0 {
+		t.Fatalf("Validate() of the defaults returned problems: %v", problems)
+	}
+
+	tests := map[string]func(*Config){
+		"log-level":                  func(c *Config) { c.LogLevel = "500" },
+		"log-format":                 func(c *Config) { c.LogFormat = "xml" },
+		"time-zone":                  func(c *Config) { c.TimeZoneLocal = "Mars/Olympus" },
+		"webserver-port":             func(c *Config) { c.WebServerPort = 70000 },
+		"metrics-port":               func(c *Config) { c.MetricsPort = c.WebServerPort },
+		"admin-port":                 func(c *Config) { c.AdminPort = c.MetricsPort },
+		"admin-auth":                 func(c *Config) { c.AdminAuth = "oidc" },
+		"hook-timeout":               func(c *Config) { c.HookTimeout = -1 },
+		"label-prefix":               func(c *Config) { c.LabelPrefix = "Managed_By" },
+		"custom-labels":              func(c *Config) { c.CustomLabels = map[string]string{"bad key": "x"} },
+		"custom-labels.team":         func(c *Config) { c.CustomLabels = map[string]string{"team": "has spaces"} },
+		"excluded-namespaces":        func(c *Config) { c.ExcludedNamespaces = []string{"Not.A.Namespace"} },
+		"failure-policy":             func(c *Config) { c.FailurePolicy = "fail" },
+		"failure-policies.pod":       func(c *Config) { c.FailurePolicies = map[string]string{"pod": "Sometimes"} },
+		"appid-change-policy":        func(c *Config) { c.AppIDChangePolicy = "delete" },
+		"backfill-qps":               func(c *Config) { c.BackfillQPS = 0 },
+		"backfill-selector":          func(c *Config) { c.BackfillSelector = "app in (" },
+		"certificate.certificate":    func(c *Config) { c.CertCert = "not a certificate" },
+		"certificate-authority.priv": func(c *Config) { c.CAPrivateKey = "not a key" },
+	}
+
+	for key, modify := range tests {
+		c := defaultConfig(t)
+		modify(&c)
+		problems := c.Validate()
+		if len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), key) {
+			t.Errorf("Validate() returned incorrect problems for %s, got %v", key, problems)
+		}
+	}
+}
+
+func TestValidateFileSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key")}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"certificate:\n  private-key-file: " + key + "\n":                           "",
+		"certificate:\n  private-key-file: " + filepath.Join(dir, "missing") + "\n": "certificate.private-key-file",
+		"certificate:\n  private-key-file: " + filepath.Join(dir, "cert") + "\n":    "certificate.private-key: must be a PEM encoded private key",
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cert"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for content, want := range tests {
+		path := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		problems := ValidateFile(path)
+		switch {
+		case want == "" && len(problems) > 0:
+			t.Errorf("ValidateFile() returned problems for %q: %v", content, problems)
+		case want != "" && (len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), want)):
+			t.Errorf("ValidateFile() returned incorrect problems for %q, got %v, wanted %q", content, problems, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package drift
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/operations"
+)
+
+// ErrNotSynced is returned while the informer caches are still filling.
+var ErrNotSynced = errors.New("namespace and pod caches have not synced yet")
+
+// Pod identifies a pod whose appid label is missing or disagrees with its namespace.
+type Pod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	AppID     string `json:"appid,omitempty"`
+	Expected  string `json:"expected"`
+}
+
+// Report lists the objects that are invisible to, or misattributed in, cost allocation.
+type Report struct {
+	GeneratedAt            time.Time `json:"generatedAt"`
+	NamespacesWithoutAppID []string  `json:"namespacesWithoutAppID"`
+	PodsMissingLabel       []Pod     `json:"podsMissingLabel"`
+	PodsMismatchedLabel    []Pod     `json:"podsMismatchedLabel"`
+}
+
+// Reporter builds drift reports from the cached namespace and pod informers, so a report never
+// lists objects against the API server.
+type Reporter struct {
+	cfg        *config.Store
+	namespaces corelisters.NamespaceLister
+	pods       corelisters.PodLister
+	synced     []cache.InformerSynced
+}
+
+// NewReporter registers namespace and pod informers with factory. The factory must be started
+// before reports can be built. Cached pods are stripped to their metadata to keep memory low.
+func NewReporter(factory informers.SharedInformerFactory, cfg *config.Store) *Reporter {
+	namespaces := factory.Core().V1().Namespaces()
+	pods := factory.Core().V1().Pods()
+	_ = pods.Informer().SetTransform(stripPod)
+
+	return &Reporter{
+		cfg:        cfg,
+		namespaces: namespaces.Lister(),
+		pods:       pods.Lister(),
+		synced:     []cache.InformerSynced{namespaces.Informer().HasSynced, pods.Informer().HasSynced},
+	}
+}
+
+// Report returns the current drift report.
+func (r *Reporter) Report() (*Report, error) {
+	for _, synced := range r.synced {
+		if !synced() {
+			return nil, ErrNotSynced
+		}
+	}
+
+	namespaces, err := r.namespaces.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := r.pods.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return Build(r.cfg.Load(), namespaces, pods), nil
+}
+
+// Build compares the appid label of every pod with the appid of its namespace. Excluded namespaces
+// are skipped, and pods in namespaces without an appid are only reported through their namespace.
+func Build(cfg *config.Config, namespaces []*core.Namespace, pods []*core.Pod) *Report {
+	report := &Report{
+		GeneratedAt:            time.Now().UTC(),
+		NamespacesWithoutAppID: []string{},
+		PodsMissingLabel:       []Pod{},
+		PodsMismatchedLabel:    []Pod{},
+	}
+
+	appids := make(map[string]string, len(namespaces))
+	for _, ns := range namespaces {
+		if cfg.IsNamespaceExcluded(ns.Name) {
+			continue
+		}
+		appid, _ := operations.ResolveAppID(ns)
+		if appid == "" {
+			report.NamespacesWithoutAppID = append(report.NamespacesWithoutAppID, ns.Name)
+			continue
+		}
+		appids[ns.Name] = appid
+	}
+
+	key := cfg.AppIDLabel()
+	for _, pod := range pods {
+		expected, ok := appids[pod.Namespace]
+		if !ok {
+			continue
+		}
+		appid, labeled := pod.Labels[key]
+		switch {
+		case !labeled:
+			report.PodsMissingLabel = append(report.PodsMissingLabel, Pod{Namespace: pod.Namespace, Name: pod.Name, Expected: expected})
+		case appid != expected:
+			report.PodsMismatchedLabel = append(report.PodsMismatchedLabel, Pod{Namespace: pod.Namespace, Name: pod.Name, AppID: appid, Expected: expected})
+		}
+	}
+
+	sort.Strings(report.NamespacesWithoutAppID)
+	sortPods(report.PodsMissingLabel)
+	sortPods(report.PodsMismatchedLabel)
+	return report
+}
+
+func sortPods(pods []Pod) {
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+}
+
+// stripPod drops everything but the identity and labels of a pod before it is cached.
+func stripPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*core.Pod)
+	if !ok {
+		return obj, nil
+	}
+	return &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+			Labels:          pod.Labels,
+		},
+	}, nil
+}
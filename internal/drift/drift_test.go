@@ -0,0 +1,45 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"mutating-webhook/internal/config"
+)
+
+func TestBuild(t *testing.T) {
+	cfg := config.Config{LabelPrefix: "managed-by"}
+	cfg.CompileExclusions()
+
+	namespaces := []*core.Namespace{
+		{ObjectMeta: meta.ObjectMeta{Name: "team-a", Annotations: map[string]string{"appid": "app-a"}}},
+		{ObjectMeta: meta.ObjectMeta{Name: "team-c"}},
+		{ObjectMeta: meta.ObjectMeta{Name: "team-b"}},
+		{ObjectMeta: meta.ObjectMeta{Name: "kube-system"}},
+	}
+	pod := func(namespace, name string, labels map[string]string) *core.Pod {
+		return &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+	}
+	pods := []*core.Pod{
+		pod("team-a", "ok", map[string]string{"managed-by/appid": "app-a"}),
+		pod("team-a", "stale", map[string]string{"managed-by/appid": "old"}),
+		pod("team-a", "unlabeled", nil),
+		pod("team-b", "unlabeled", nil),
+		pod("kube-system", "unlabeled", nil),
+	}
+
+	report := Build(&cfg, namespaces, pods)
+
+	if want := []string{"team-b", "team-c"}; !reflect.DeepEqual(report.NamespacesWithoutAppID, want) {
+		t.Errorf("Build() returned incorrect namespaces without appid, got %v, wanted %v", report.NamespacesWithoutAppID, want)
+	}
+	if want := []Pod{{Namespace: "team-a", Name: "unlabeled", Expected: "app-a"}}; !reflect.DeepEqual(report.PodsMissingLabel, want) {
+		t.Errorf("Build() returned incorrect pods missing the label, got %v, wanted %v", report.PodsMissingLabel, want)
+	}
+	if want := []Pod{{Namespace: "team-a", Name: "stale", AppID: "old", Expected: "app-a"}}; !reflect.DeepEqual(report.PodsMismatchedLabel, want) {
+		t.Errorf("Build() returned incorrect pods with a mismatched label, got %v, wanted %v", report.PodsMismatchedLabel, want)
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// component is reported as the source of every event.
+const component = "appid-webhook"
+
+// Recorder emits Kubernetes events against namespaces. Implementations must never block the
+// caller.
+type Recorder interface {
+	Namespace(namespace, eventType, reason, message string)
+}
+
+// Nop returns a Recorder that discards every event.
+func Nop() Recorder {
+	return nopRecorder{}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Namespace(namespace, eventType, reason, message string) {}
+
+// recorder emits events through the client-go event broadcaster, which queues them and drops
+// events when its queue is full. On top of the broadcaster's own spam filter, each namespace and
+// reason pair is limited to one event per interval.
+type recorder struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	interval    time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+	// pruned is when expired entries were last removed from last
+	pruned time.Time
+}
+
+// New returns a Recorder writing events through client, emitting at most one event per namespace
+// and reason every interval. The returned function stops the broadcaster.
+func New(client kubernetes.Interface, interval time.Duration) (Recorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcore.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	r := &recorder{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: component}),
+		interval:    interval,
+		last:        make(map[string]time.Time),
+	}
+	return r, broadcaster.Shutdown
+}
+
+func (r *recorder) Namespace(namespace, eventType, reason, message string) {
+	if namespace == "" || !r.allow(namespace+"/"+reason) {
+		return
+	}
+
+	ref := &core.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       namespace,
+		Namespace:  namespace,
+	}
+	r.recorder.Event(ref, eventType, reason, message)
+}
+
+// allow reports whether an event for key may be emitted now and records the emission.
+func (r *recorder) allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+	if last, ok := r.last[key]; ok && now.Sub(last) < r.interval {
+		return false
+	}
+	r.last[key] = now
+	return true
+}
+
+// prune removes the entries whose interval has passed, at most once per interval, so the map only
+// holds the keys seen during the last two intervals. The caller must hold mu.
+func (r *recorder) prune(now time.Time) {
+	if now.Sub(r.pruned) < r.interval {
+		return
+	}
+	for key, last := range r.last {
+		if now.Sub(last) >= r.interval {
+			delete(r.last, key)
+		}
+	}
+	r.pruned = now
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRecorderRateLimit(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	r := &recorder{
+		recorder: fake,
+		interval: time.Hour,
+		last:     make(map[string]time.Time),
+	}
+
+	r.Namespace("team-a", core.EventTypeWarning, "MissingAppID", "first")
+	r.Namespace("team-a", core.EventTypeWarning, "MissingAppID", "repeated")
+	r.Namespace("team-a", core.EventTypeWarning, "AdmissionDenied", "other reason")
+	r.Namespace("team-b", core.EventTypeWarning, "MissingAppID", "other namespace")
+	r.Namespace("", core.EventTypeWarning, "MissingAppID", "cluster scope")
+
+	if len(fake.Events) != 3 {
+		t.Errorf("Namespace() emitted %d events, wanted 3", len(fake.Events))
+	}
+}
+
+func TestRecorderPrune(t *testing.T) {
+	r := &recorder{
+		recorder: record.NewFakeRecorder(10),
+		interval: time.Minute,
+		last: map[string]time.Time{
+			"team-a/MissingAppID": time.Now().Add(-2 * time.Minute),
+			"team-b/MissingAppID": time.Now(),
+		},
+	}
+
+	r.Namespace("team-c", core.EventTypeWarning, "MissingAppID", "new")
+	if _, ok := r.last["team-a/MissingAppID"]; ok || len(r.last) != 2 {
+		t.Errorf("Namespace() did not prune expired entries, got %v", r.last)
+	}
+}
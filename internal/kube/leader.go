@@ -0,0 +1,55 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// RunLeaderElected runs fn on the replica holding the named Lease in namespace, until ctx is
+// cancelled. fn receives a context that is cancelled when leadership is lost. When several replicas
+// of the webhook are running this keeps background controllers from doing the same work once per
+// replica.
+func RunLeaderElected(ctx context.Context, client kubernetes.Interface, namespace, name string, fn func(ctx context.Context)) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to determine leader election identity: %w", err)
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  meta.ObjectMeta{Name: name, Namespace: namespace},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		ReleaseOnCancel: true,
+		LeaseDuration:   30 * time.Second,
+		RenewDeadline:   20 * time.Second,
+		RetryPeriod:     5 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				slog.Info("Elected leader", "lease", name, "identity", identity)
+				fn(ctx)
+			},
+			OnStoppedLeading: func() {
+				slog.Info("Stopped leading", "lease", name, "identity", identity)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	// Run returns when leadership is lost, so campaign again until the webhook shuts down
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+	return nil
+}
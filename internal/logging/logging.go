@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LevelTrace is more verbose than slog.LevelDebug and is used for per request tracing.
+const LevelTrace = slog.Level(-8)
+
+// Supported output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// level is shared by every handler created by Setup so the level can change at runtime.
+var level = new(slog.LevelVar)
+
+type contextKey struct{}
+
+// ParseLevel converts a level name (trace, debug, info, warn, error) to a slog.Level. For backwards
+// compatibility the legacy numeric levels from 0 to 100 are also accepted.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 100 {
+		return slog.LevelInfo, fmt.Errorf("unknown log level '%s', expected one of trace, debug, info, warn or error", s)
+	}
+	switch {
+	case n <= 20:
+		return slog.LevelError, nil
+	case n <= 40:
+		return slog.LevelWarn, nil
+	case n <= 60:
+		return slog.LevelInfo, nil
+	case n <= 80:
+		return slog.LevelDebug, nil
+	}
+	return LevelTrace, nil
+}
+
+// LevelName returns the lower case name of the level as accepted by ParseLevel.
+func LevelName(l slog.Level) string {
+	if l <= LevelTrace {
+		return "trace"
+	}
+	return strings.ToLower(l.String())
+}
+
+// Setup installs a JSON or text logger writing to w as the default slog logger. The standard
+// library log package is routed through it as well.
+func Setup(w io.Writer, format string, l slog.Level) error {
+	level.Set(l)
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceLevelName,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText, "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format '%s', expected %s or %s", format, FormatText, FormatJSON)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the minimum level of the default logger without restarting.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Level returns the current minimum level of the default logger.
+func Level() slog.Level {
+	return level.Level()
+}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Trace logs at LevelTrace using the logger stored in ctx.
+func Trace(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).Log(ctx, LevelTrace, msg, args...)
+}
+
+// Fatal logs at error level and exits the process.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func replaceLevelName(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if l, ok := a.Value.Any().(slog.Level); ok && l <= LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
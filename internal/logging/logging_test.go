@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"trace":   LevelTrace,
+		"DEBUG":   slog.LevelDebug,
+		"info":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"20":      slog.LevelError,
+		"60":      slog.LevelInfo,
+		"100":     LevelTrace,
+	}
+	for input, expected := range tests {
+		result, err := ParseLevel(input)
+		if err != nil {
+			t.Errorf("ParseLevel(%q) returned an unexpected error: %v", input, err)
+		}
+		if result != expected {
+			t.Errorf("ParseLevel(%q) returned incorrect value, got %v, wanted %v", input, result, expected)
+		}
+	}
+
+	for _, input := range []string{"verbose", "500", "-1"} {
+		if _, err := ParseLevel(input); err == nil {
+			t.Errorf("ParseLevel(%q) did not return an error", input)
+		}
+	}
+}
+
+func TestSetupJSON(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, FormatJSON, slog.LevelInfo); err != nil {
+		t.Fatalf("Setup() returned an unexpected error: %v", err)
+	}
+
+	slog.Debug("hidden")
+	SetLevel(LevelTrace)
+	Trace(NewContext(context.Background(), slog.Default().With("uid", "1234")), "visible")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Setup() did not produce a single JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["level"] != "TRACE" || line["msg"] != "visible" || line["uid"] != "1234" {
+		t.Errorf("Setup() produced an unexpected log line: %v", line)
+	}
+}
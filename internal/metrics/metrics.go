@@ -28,6 +28,15 @@ var (
 		[]string{"operation", "resource"},
 	)
 
+	hookDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "webhook_hook_duration_seconds",
+			Help:    "Duration of admission hook execution in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation", "resource"},
+	)
+
 	// Labeling metrics
 	labelsAppliedTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -45,6 +54,14 @@ var (
 		[]string{"namespace", "mutation_type", "success"},
 	)
 
+	appIDDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "webhook_appid_drift_objects",
+			Help: "Number of pods and workloads whose appid label does not match the appid of their namespace",
+		},
+		[]string{"namespace"},
+	)
+
 	// Error metrics
 	errorsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -54,6 +71,22 @@ var (
 		[]string{"error_type", "operation"},
 	)
 
+	// Configuration metrics
+	configReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_config_reloads_total",
+			Help: "Total number of configuration file reloads",
+		},
+		[]string{"success"},
+	)
+
+	configLastReload = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "webhook_config_last_reload_success_timestamp",
+			Help: "Timestamp of the last configuration file reload that was applied",
+		},
+	)
+
 	// Health metrics
 	webhookUp = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -75,9 +108,13 @@ func init() {
 	prometheus.MustRegister(
 		admissionRequestsTotal,
 		admissionRequestDuration,
+		hookDuration,
 		labelsAppliedTotal,
 		mutationsTotal,
+		appIDDrift,
 		errorsTotal,
+		configReloadsTotal,
+		configLastReload,
 		webhookUp,
 		certificateExpiryTime,
 	)
@@ -101,6 +138,14 @@ func RecordAdmissionRequest(operation, resource, namespace string, allowed bool,
 	).Observe(duration.Seconds())
 }
 
+// RecordHookDuration records how long an admission hook took to run
+func RecordHookDuration(operation, resource string, duration time.Duration) {
+	hookDuration.WithLabelValues(
+		operation,
+		resource,
+	).Observe(duration.Seconds())
+}
+
 // RecordLabelsApplied records metrics for applied labels
 func RecordLabelsApplied(namespace, workloadType string, count int) {
 	labelsAppliedTotal.WithLabelValues(
@@ -118,6 +163,16 @@ func RecordMutation(namespace, mutationType string, success bool) {
 	).Inc()
 }
 
+// SetAppIDDrift records the number of objects in a namespace still labeled with a stale appid. A
+// count of zero removes the series.
+func SetAppIDDrift(namespace string, count int) {
+	if count == 0 {
+		appIDDrift.DeleteLabelValues(namespace)
+		return
+	}
+	appIDDrift.WithLabelValues(namespace).Set(float64(count))
+}
+
 // RecordError records error metrics
 func RecordError(errorType, operation string) {
 	errorsTotal.WithLabelValues(
@@ -126,6 +181,14 @@ func RecordError(errorType, operation string) {
 	).Inc()
 }
 
+// RecordConfigReload records the outcome of a configuration file reload
+func RecordConfigReload(success bool) {
+	configReloadsTotal.WithLabelValues(strconv.FormatBool(success)).Inc()
+	if success {
+		configLastReload.SetToCurrentTime()
+	}
+}
+
 // SetCertificateExpiry sets the certificate expiry timestamp
 func SetCertificateExpiry(expiryTime time.Time) {
 	certificateExpiryTime.Set(float64(expiryTime.Unix()))
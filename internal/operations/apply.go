@@ -0,0 +1,47 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// strictDecoder rejects unknown and duplicate fields, so a patch that writes to a misspelled or
+// badly escaped path fails instead of being silently dropped by the API server.
+var strictDecoder = kjson.NewSerializerWithOptions(kjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme,
+	kjson.SerializerOptions{Strict: true})
+
+// ApplyPatch applies the operations to the JSON object like the API server does and returns the
+// patched object. The result must still decode strictly as gvk, or as the kind declared by the
+// object when gvk is empty.
+func ApplyPatch(gvk schema.GroupVersionKind, object []byte, ops []PatchOperation) ([]byte, error) {
+	patched := object
+	if len(ops) > 0 {
+		data, err := json.Marshal(ops)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal JSON patch: %w", err)
+		}
+		patch, err := jsonpatch.DecodePatch(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON patch: %w", err)
+		}
+		if patched, err = patch.Apply(object); err != nil {
+			return nil, fmt.Errorf("could not apply JSON patch: %w", err)
+		}
+	}
+
+	var defaults *schema.GroupVersionKind
+	if !gvk.Empty() {
+		defaults = &gvk
+	}
+	if _, decoded, err := strictDecoder.Decode(patched, defaults, nil); err != nil {
+		return nil, fmt.Errorf("patched object does not decode as %s: %w", gvk.Kind, err)
+	} else if !gvk.Empty() && *decoded != gvk {
+		return nil, fmt.Errorf("patched object decodes as %s, expected %s", decoded, gvk)
+	}
+	return patched, nil
+}
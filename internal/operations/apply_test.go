@@ -0,0 +1,65 @@
+package operations
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestApplyPatch(t *testing.T) {
+	podKind := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	pod := `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web","labels":{"app":"web"}}}`
+	unlabeled := `{"metadata":{"name":"web"}}`
+
+	tests := []struct {
+		name   string
+		object string
+		ops    []PatchOperation
+		want   string
+		err    string
+	}{
+		{
+			name:   "escaped label key",
+			object: pod,
+			ops:    []PatchOperation{AddPatchOperation(Pointer("metadata", "labels", "managed-by/appid"), "app-1")},
+			want:   `{"apiVersion":"v1","kind":"Pod","metadata":{"labels":{"app":"web","managed-by/appid":"app-1"},"name":"web"}}`,
+		},
+		{
+			name:   "labels created when missing",
+			object: unlabeled,
+			ops:    []PatchOperation{AddPatchOperation(Pointer("metadata", "labels"), map[string]string{"managed-by/appid": "app-1"})},
+			want:   `{"metadata":{"labels":{"managed-by/appid":"app-1"},"name":"web"}}`,
+		},
+		{
+			name:   "unescaped label key",
+			object: pod,
+			ops:    []PatchOperation{AddPatchOperation("/metadata/labels/managed-by/appid", "app-1")},
+			err:    "could not apply JSON patch",
+		},
+		{
+			name:   "escape outside of labels",
+			object: pod,
+			ops:    []PatchOperation{AddPatchOperation("/metadata/labels~1appid", "app-1")},
+			err:    "does not decode",
+		},
+		{
+			name:   "label value of the wrong type",
+			object: pod,
+			ops:    []PatchOperation{AddPatchOperation("/metadata/labels/team", 1)},
+			err:    "does not decode",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ApplyPatch(podKind, []byte(tt.object), tt.ops)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: ApplyPatch() returned incorrect error, got %v, wanted %q", tt.name, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: ApplyPatch() returned an error: %v", tt.name, err)
+		case tt.err == "" && string(got) != tt.want:
+			t.Errorf("%s: ApplyPatch() returned incorrect value, got %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package operations
 
 import (
+	"context"
 	admission "k8s.io/api/admission/v1"
 
 	"mutating-webhook/internal/config"
@@ -8,17 +9,18 @@ import (
 
 func DeploymentsValidation() Hook {
 	return Hook{
+		Name: "deployment-validation",
 		// default allow
-		Create: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Delete: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Delete: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Update: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Update: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Connect: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Connect: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
 	}
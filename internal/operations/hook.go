@@ -3,6 +3,7 @@ package operations
 //https://github.com/douglasmakey/admissioncontroller
 
 import (
+	"context"
 	"fmt"
 
 	admission "k8s.io/api/admission/v1"
@@ -10,18 +11,32 @@ import (
 	"mutating-webhook/internal/config"
 )
 
-// Result contains the result of an admission request
+// Result contains the result of an admission request. AppID and AppIDSource describe the appid
+// resolved by the hook, if any, and are carried for logging and auditing. Reason is a machine
+// readable explanation of an allowed request that was left unchanged. AuditAnnotations are attached
+// to the admission response.
 type Result struct {
-	Allowed  bool
-	Msg      string
-	PatchOps []PatchOperation
+	Allowed          bool
+	Msg              string
+	Reason           string
+	AppID            string
+	AppIDSource      string
+	PatchOps         []PatchOperation
+	AuditAnnotations map[string]string
+
+	// DryRunPatchOps is the patch dry run mode withheld from the response, kept for the audit
+	DryRunPatchOps []PatchOperation
 }
 
-// AdmitFunc defines how to process an admission request
-type AdmitFunc func(request *admission.AdmissionRequest, cfg *config.Config) (*Result, error)
+// AdmitFunc defines how to process an admission request.
+// The context carries the deadline and cancellation of the incoming HTTP request and must be
+// passed to every lookup the function performs.
+type AdmitFunc func(ctx context.Context, request *admission.AdmissionRequest, cfg *config.Config) (*Result, error)
 
-// Hook represents the set of functions for each operation in an admission webhook.
+// Hook represents the set of functions for each operation in an admission webhook. Name identifies
+// the hook in logs and selects its failure policy from the configuration.
 type Hook struct {
+	Name    string
 	Create  AdmitFunc
 	Delete  AdmitFunc
 	Update  AdmitFunc
@@ -29,25 +44,25 @@ type Hook struct {
 }
 
 // Execute evaluates the request and try to execute the function for operation specified in the request.
-func (h *Hook) Execute(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+func (h *Hook) Execute(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 	switch r.Operation {
 	case admission.Create:
-		return wrapperExecution(h.Create, r, cfg)
+		return wrapperExecution(ctx, h.Create, r, cfg)
 	case admission.Update:
-		return wrapperExecution(h.Update, r, cfg)
+		return wrapperExecution(ctx, h.Update, r, cfg)
 	case admission.Delete:
-		return wrapperExecution(h.Delete, r, cfg)
+		return wrapperExecution(ctx, h.Delete, r, cfg)
 	case admission.Connect:
-		return wrapperExecution(h.Connect, r, cfg)
+		return wrapperExecution(ctx, h.Connect, r, cfg)
 	}
 
 	return &Result{Msg: fmt.Sprintf("Invalid operation: %s", r.Operation)}, nil
 }
 
-func wrapperExecution(fn AdmitFunc, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+func wrapperExecution(ctx context.Context, fn AdmitFunc, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 	if fn == nil {
 		return nil, fmt.Errorf("operation %s is not registered", r.Operation)
 	}
 
-	return fn(r, cfg)
+	return fn(ctx, r, cfg)
 }
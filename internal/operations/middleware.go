@@ -0,0 +1,335 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	admission "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"mutating-webhook/internal/audit"
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/logging"
+	"mutating-webhook/internal/metrics"
+)
+
+// Reasons reported in Result.Reason and used for Kubernetes events.
+const (
+	ReasonMissingAppID = "MissingAppID"
+	ReasonDenied       = "AdmissionDenied"
+)
+
+// Middleware wraps an AdmitFunc with behaviour that is shared between hooks.
+type Middleware func(AdmitFunc) AdmitFunc
+
+// Chain composes middleware into a single Middleware. The first middleware listed is the
+// outermost and sees the request first.
+func Chain(mw ...Middleware) Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		for i := len(mw) - 1; i >= 0; i-- {
+			fn = mw[i](fn)
+		}
+		return fn
+	}
+}
+
+// With returns a copy of the hook with the middleware applied to every registered operation. The
+// middleware can look the name of the hook up with hookName.
+func (h Hook) With(mw ...Middleware) Hook {
+	chain := Chain(mw...)
+	name := h.Name
+	wrap := func(fn AdmitFunc) AdmitFunc {
+		if fn == nil {
+			return nil
+		}
+		fn = chain(fn)
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			return fn(context.WithValue(ctx, hookNameKey{}, name), r, cfg)
+		}
+	}
+
+	return Hook{
+		Name:    h.Name,
+		Create:  wrap(h.Create),
+		Delete:  wrap(h.Delete),
+		Update:  wrap(h.Update),
+		Connect: wrap(h.Connect),
+	}
+}
+
+// hookNameKey is the context key of the name of the hook a middleware chain runs for.
+type hookNameKey struct{}
+
+// hookName returns the name of the hook whose middleware chain is handling the request.
+func hookName(ctx context.Context) string {
+	name, _ := ctx.Value(hookNameKey{}).(string)
+	return name
+}
+
+// bypass is the runtime toggle set through the admin endpoint.
+var bypass atomic.Bool
+
+// SetBypass enables or disables the runtime bypass of mutating hooks.
+func SetBypass(enabled bool) {
+	bypass.Store(enabled)
+}
+
+// Bypassed reports whether the runtime bypass is enabled.
+func Bypassed() bool {
+	return bypass.Load()
+}
+
+// Recover converts a panic inside the hook into an error so a single bad request cannot take down
+// the webhook server.
+func Recover() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (result *Result, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					logging.FromContext(ctx).Error("Recovered from panic in hook", "panic", p)
+					metrics.RecordError("hook_panic", string(r.Operation))
+					result, err = nil, fmt.Errorf("hook panicked: %v", p)
+				}
+			}()
+
+			return fn(ctx, r, cfg)
+		}
+	}
+}
+
+// Timing records how long the wrapped hook took to run.
+func Timing() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			start := time.Now()
+			result, err := fn(ctx, r, cfg)
+			duration := time.Since(start)
+
+			metrics.RecordHookDuration(string(r.Operation), r.Kind.Kind, duration)
+			logging.Trace(ctx, "Hook completed", "duration", duration)
+			return result, err
+		}
+	}
+}
+
+// Deadline bounds the hook by HookTimeout, which should be shorter than the timeoutSeconds of the
+// webhook registration so the webhook answers before the API server gives up. Exceeding the
+// deadline is reported as an error and handled by the failure policy of the hook.
+func Deadline() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			if cfg.HookTimeout <= 0 {
+				return fn(ctx, r, cfg)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, cfg.HookTimeout)
+			defer cancel()
+
+			result, err := fn(ctx, r, cfg)
+			if ctx.Err() != context.DeadlineExceeded {
+				return result, err
+			}
+
+			metrics.RecordError("hook_deadline_exceeded", string(r.Operation))
+			return nil, fmt.Errorf("admission hook did not complete within %s: %w", cfg.HookTimeout, context.DeadlineExceeded)
+		}
+	}
+}
+
+// Exclusion allows requests in excluded namespaces without running the hook. The exclusion set
+// is compiled when the configuration is loaded.
+func Exclusion() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			if cfg.IsNamespaceExcluded(r.Namespace) {
+				logging.FromContext(ctx).Debug("Namespace is excluded from admission processing")
+				return &Result{Allowed: true}, nil
+			}
+
+			return fn(ctx, r, cfg)
+		}
+	}
+}
+
+// Bypass allows requests without running the hook when labeling is disabled or the runtime bypass
+// is enabled.
+func Bypass() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			switch {
+			case !cfg.EnableLabeling:
+				logging.FromContext(ctx).Debug("Custom labeling is disabled")
+				return &Result{Allowed: true}, nil
+			case Bypassed():
+				logging.FromContext(ctx).Debug("Runtime bypass is enabled, skipping")
+				return &Result{Allowed: true}, nil
+			}
+
+			return fn(ctx, r, cfg)
+		}
+	}
+}
+
+// DryRun runs the hook and, when dry run mode is enabled, logs the patch it would have applied
+// instead of returning it. The patch is kept in Result.DryRunPatchOps so Audit still records it.
+func DryRun() Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			result, err := fn(ctx, r, cfg)
+			if err != nil || result == nil || !cfg.DryRun || len(result.PatchOps) == 0 {
+				return result, err
+			}
+
+			for _, op := range result.PatchOps {
+				logging.FromContext(ctx).Info("DRY RUN: Would apply patch", "op", op.Op, "path", op.Path, "value", op.Value)
+			}
+			result.DryRunPatchOps, result.PatchOps = result.PatchOps, nil
+			return result, nil
+		}
+	}
+}
+
+// Audit logs the admission decision made by the hook, sends an audit record to the auditor and
+// attaches the decision to the response as audit annotations so it shows up in the API server
+// audit log. A nil auditor only logs.
+func Audit(auditor *audit.Auditor) Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			result, err := fn(ctx, r, cfg)
+
+			rec := audit.Record{
+				UID:       string(r.UID),
+				Hook:      hookName(ctx),
+				Operation: string(r.Operation),
+				Object: audit.ObjectReference{
+					APIVersion: schema.GroupVersion{Group: r.Kind.Group, Version: r.Kind.Version}.String(),
+					Kind:       r.Kind.Kind,
+					Namespace:  r.Namespace,
+					Name:       r.Name,
+				},
+				User:   r.UserInfo.Username,
+				DryRun: cfg.DryRun,
+			}
+			if meta, perr := parseObjectMeta(r.Object.Raw); perr == nil {
+				rec.LabelsBefore = meta.Labels
+				if rec.Object.Name == "" {
+					rec.Object.Name = meta.Name
+				}
+			}
+
+			switch {
+			case err != nil:
+				logging.FromContext(ctx).Info("Admission decision", "error", err)
+				rec.Error = err.Error()
+			case result != nil:
+				logging.FromContext(ctx).Info("Admission decision", "allowed", result.Allowed, "appid", result.AppID, "patches", len(result.PatchOps), "message", result.Msg)
+				rec.AppID = result.AppID
+				rec.Source = result.AppIDSource
+				rec.Allowed = result.Allowed
+				rec.Message = result.Msg
+				// in dry run mode record the patch that would have been applied
+				ops := result.PatchOps
+				if len(result.DryRunPatchOps) > 0 {
+					ops = result.DryRunPatchOps
+				}
+				rec.LabelsAfter = patchedLabels(rec.LabelsBefore, ops)
+				if len(ops) > 0 {
+					rec.Patch, _ = json.Marshal(ops)
+				}
+				result.AuditAnnotations = auditAnnotations(result)
+			}
+
+			auditor.Record(rec)
+			return result, err
+		}
+	}
+}
+
+// Events emits Kubernetes events against the namespace of the request when a pod is admitted
+// without an appid or a request is denied. The recorder is asynchronous and rate limited so the
+// admission path is never blocked.
+func Events(recorder events.Recorder) Middleware {
+	return func(fn AdmitFunc) AdmitFunc {
+		return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			result, err := fn(ctx, r, cfg)
+			if err != nil || result == nil {
+				return result, err
+			}
+
+			switch {
+			case !result.Allowed:
+				recorder.Namespace(r.Namespace, core.EventTypeWarning, ReasonDenied,
+					fmt.Sprintf("%s of %s %s was denied: %s", r.Operation, r.Kind.Kind, r.Name, result.Msg))
+			case result.Reason == ReasonMissingAppID:
+				recorder.Namespace(r.Namespace, core.EventTypeWarning, ReasonMissingAppID,
+					fmt.Sprintf("%s objects are admitted without an appid label because the namespace has no appid annotation or label", r.Kind.Kind))
+			}
+			return result, err
+		}
+	}
+}
+
+// auditAnnotations summarizes the decision for the API server audit log. The API server prefixes
+// each key with the name of the webhook.
+func auditAnnotations(result *Result) map[string]string {
+	annotations := map[string]string{}
+	switch {
+	case !result.Allowed:
+		annotations["decision"] = "denied"
+	case len(result.PatchOps) > 0:
+		annotations["decision"] = "mutated"
+	case len(result.DryRunPatchOps) > 0:
+		annotations["decision"] = "dry-run"
+	default:
+		annotations["decision"] = "unchanged"
+	}
+	if result.AppID != "" {
+		annotations["appid"] = result.AppID
+	}
+	if result.AppIDSource != "" {
+		annotations["appid-source"] = result.AppIDSource
+	}
+	return annotations
+}
+
+// patchedLabels returns the labels that result from applying the label operations of the patch to
+// the original labels. Operations outside of /metadata/labels are ignored.
+func patchedLabels(before map[string]string, ops []PatchOperation) map[string]string {
+	after := make(map[string]string, len(before))
+	for k, v := range before {
+		after[k] = v
+	}
+
+	const labelsPath = "/metadata/labels"
+	for _, op := range ops {
+		switch {
+		case op.Path == labelsPath && op.Op == removeOperation:
+			after = map[string]string{}
+		case op.Path == labelsPath:
+			if labels, ok := op.Value.(map[string]string); ok {
+				after = make(map[string]string, len(labels))
+				for k, v := range labels {
+					after[k] = v
+				}
+			}
+		case strings.HasPrefix(op.Path, labelsPath+"/"):
+			key := pointerUnescaper.Replace(strings.TrimPrefix(op.Path, labelsPath+"/"))
+			if op.Op == removeOperation {
+				delete(after, key)
+			} else if value, ok := op.Value.(string); ok {
+				after[key] = value
+			}
+		}
+	}
+
+	if len(after) == 0 {
+		return nil
+	}
+	return after
+}
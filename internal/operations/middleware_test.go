@@ -0,0 +1,246 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	admission "k8s.io/api/admission/v1"
+
+	"mutating-webhook/internal/audit"
+	"mutating-webhook/internal/config"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(fn AdmitFunc) AdmitFunc {
+			return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+				order = append(order, name)
+				return fn(ctx, r, cfg)
+			}
+		}
+	}
+
+	hook := Hook{
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			order = append(order, "hook")
+			return &Result{Allowed: true}, nil
+		},
+	}.With(mark("first"), mark("second"))
+
+	if _, err := hook.Execute(context.Background(), &admission.AdmissionRequest{Operation: admission.Create}, &config.Config{}); err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %v", err)
+	}
+
+	expected := []string{"first", "second", "hook"}
+	if len(order) != len(expected) {
+		t.Fatalf("Chain() ran %v, wanted %v", order, expected)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("Chain() ran %v, wanted %v", order, expected)
+		}
+	}
+
+	if hook.Delete != nil {
+		t.Errorf("With() registered an operation that was not defined on the hook")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	hook := Hook{
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			panic("boom")
+		},
+	}.With(Recover())
+
+	result, err := hook.Execute(context.Background(), &admission.AdmissionRequest{Operation: admission.Create}, &config.Config{})
+	if err == nil || result != nil {
+		t.Errorf("Recover() did not convert the panic into an error, got result %v and error %v", result, err)
+	}
+}
+
+func TestExclusionAndBypass(t *testing.T) {
+	cfg := &config.Config{EnableLabeling: true}
+	cfg.CompileExclusions()
+
+	called := false
+	hook := Hook{
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			called = true
+			return &Result{Allowed: true, PatchOps: []PatchOperation{AddPatchOperation("/metadata/labels", map[string]string{})}}, nil
+		},
+	}.With(Exclusion(), Bypass(), DryRun())
+
+	tests := []struct {
+		name      string
+		namespace string
+		setup     func()
+		called    bool
+		patches   int
+	}{
+		{name: "excluded namespace", namespace: "kube-system", called: false},
+		{name: "regular namespace", namespace: "team-a", called: true, patches: 1},
+		{name: "labeling disabled", namespace: "team-a", setup: func() { cfg.EnableLabeling = false }, called: false},
+		{name: "runtime bypass", namespace: "team-a", setup: func() { cfg.EnableLabeling = true; SetBypass(true) }, called: false},
+		{name: "dry run", namespace: "team-a", setup: func() { SetBypass(false); cfg.DryRun = true }, called: true, patches: 0},
+	}
+	for _, test := range tests {
+		called = false
+		if test.setup != nil {
+			test.setup()
+		}
+		result, err := hook.Execute(context.Background(), &admission.AdmissionRequest{Operation: admission.Create, Namespace: test.namespace}, cfg)
+		if err != nil {
+			t.Fatalf("%s: Execute() returned an unexpected error: %v", test.name, err)
+		}
+		if called != test.called {
+			t.Errorf("%s: hook called = %v, wanted %v", test.name, called, test.called)
+		}
+		if !result.Allowed || len(result.PatchOps) != test.patches {
+			t.Errorf("%s: got allowed %v with %d patches, wanted allowed with %d patches", test.name, result.Allowed, len(result.PatchOps), test.patches)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	hook := Hook{
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			<-ctx.Done()
+			return &Result{Allowed: true}, nil
+		},
+	}.With(Deadline())
+
+	cfg := &config.Config{HookTimeout: time.Second}
+	result, err := hook.Execute(context.Background(), &admission.AdmissionRequest{Operation: admission.Create}, cfg)
+	if !errors.Is(err, context.DeadlineExceeded) || result != nil {
+		t.Errorf("Deadline() returned result %v and error %v, wanted a deadline exceeded error", result, err)
+	}
+}
+
+func TestPatchedLabels(t *testing.T) {
+	before := map[string]string{"run": "toolbox", "team": "a"}
+	ops := []PatchOperation{
+		AddPatchOperation("/metadata/labels/managed-by~1appid", "app-1"),
+		RemovePatchOperation("/metadata/labels/team"),
+		AddPatchOperation("/spec/priority", 1),
+	}
+
+	after := patchedLabels(before, ops)
+	expected := map[string]string{"run": "toolbox", "managed-by/appid": "app-1"}
+	if len(after) != len(expected) {
+		t.Fatalf("patchedLabels() returned %v, wanted %v", after, expected)
+	}
+	for k, v := range expected {
+		if after[k] != v {
+			t.Errorf("patchedLabels() returned %v, wanted %v", after, expected)
+		}
+	}
+	if before["team"] != "a" {
+		t.Errorf("patchedLabels() modified the original labels")
+	}
+
+	after = patchedLabels(nil, []PatchOperation{AddPatchOperation("/metadata/labels", map[string]string{"managed-by/appid": "app-2"})})
+	if after["managed-by/appid"] != "app-2" {
+		t.Errorf("patchedLabels() did not apply a whole labels map, got %v", after)
+	}
+}
+
+type fakeRecorder struct {
+	reasons []string
+}
+
+func (f *fakeRecorder) Namespace(namespace, eventType, reason, message string) {
+	f.reasons = append(f.reasons, reason)
+}
+
+func TestEvents(t *testing.T) {
+	recorder := &fakeRecorder{}
+	results := []*Result{
+		{Allowed: true, Reason: ReasonMissingAppID},
+		{Allowed: false, Msg: "denied"},
+		{Allowed: true},
+	}
+	for _, res := range results {
+		res := res
+		hook := Hook{
+			Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+				return res, nil
+			},
+		}.With(Events(recorder))
+		if _, err := hook.Execute(context.Background(), &admission.AdmissionRequest{Operation: admission.Create, Namespace: "team-a"}, &config.Config{}); err != nil {
+			t.Fatalf("Execute() returned an unexpected error: %v", err)
+		}
+	}
+
+	if len(recorder.reasons) != 2 || recorder.reasons[0] != ReasonMissingAppID || recorder.reasons[1] != ReasonDenied {
+		t.Errorf("Events() emitted %v, wanted [%s %s]", recorder.reasons, ReasonMissingAppID, ReasonDenied)
+	}
+}
+
+type recordingSink struct {
+	records chan audit.Record
+}
+
+func (s *recordingSink) Write(rec audit.Record) error {
+	s.records <- rec
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestAudit(t *testing.T) {
+	sink := &recordingSink{records: make(chan audit.Record, 1)}
+	auditor := audit.New(sink, 1)
+	defer auditor.Close()
+
+	hook := Hook{
+		Name: "pod-mutation",
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			return &Result{Allowed: true, AppID: "app-1"}, nil
+		},
+	}.With(Audit(auditor))
+
+	if _, err := hook.Execute(context.Background(), &admission.AdmissionRequest{UID: "1", Operation: admission.Create}, &config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case rec := <-sink.records:
+		if rec.Hook != "pod-mutation" || rec.AppID != "app-1" {
+			t.Errorf("Audit() recorded incorrect value, got hook %q appid %q, wanted hook %q appid %q", rec.Hook, rec.AppID, "pod-mutation", "app-1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Audit() did not record the decision")
+	}
+}
+
+func TestAuditDryRun(t *testing.T) {
+	sink := &recordingSink{records: make(chan audit.Record, 1)}
+	auditor := audit.New(sink, 1)
+	defer auditor.Close()
+
+	hook := Hook{
+		Name: "pod-mutation",
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+			return &Result{Allowed: true, AppID: "app-1", PatchOps: []PatchOperation{AddPatchOperation("/metadata/labels/appid", "app-1")}}, nil
+		},
+	}.With(Audit(auditor), DryRun())
+
+	result, err := hook.Execute(context.Background(), &admission.AdmissionRequest{UID: "1", Operation: admission.Create}, &config.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.PatchOps) != 0 || result.AuditAnnotations["decision"] != "dry-run" {
+		t.Errorf("Execute() returned incorrect value, got %d patches and decision %q, wanted 0 and %q", len(result.PatchOps), result.AuditAnnotations["decision"], "dry-run")
+	}
+	select {
+	case rec := <-sink.records:
+		if !rec.DryRun || len(rec.Patch) == 0 || rec.LabelsAfter["appid"] != "app-1" {
+			t.Errorf("Audit() recorded incorrect value, got dryRun %v patch %s labels after %v, wanted the withheld patch", rec.DryRun, rec.Patch, rec.LabelsAfter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Audit() did not record the decision")
+	}
+}
@@ -0,0 +1,70 @@
+package operations
+
+import (
+	"context"
+	"sync/atomic"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"mutating-webhook/internal/kube"
+)
+
+// NamespaceSource looks up the namespace of an admission request.
+type NamespaceSource interface {
+	Namespace(ctx context.Context, name string) (*core.Namespace, error)
+}
+
+// namespaceSource is the source used by the hooks. When unset, each lookup creates a clientset.
+var namespaceSource atomic.Pointer[NamespaceSource]
+
+// SetNamespaceSource sets the source the hooks look namespaces up from.
+func SetNamespaceSource(src NamespaceSource) {
+	namespaceSource.Store(&src)
+}
+
+func lookupNamespace(ctx context.Context, name string) (*core.Namespace, error) {
+	if src := namespaceSource.Load(); src != nil {
+		return (*src).Namespace(ctx, name)
+	}
+
+	clientset, err := kube.NewClientset()
+	if err != nil {
+		return nil, err
+	}
+	return ClientNamespaceSource(clientset).Namespace(ctx, name)
+}
+
+// ClientNamespaceSource returns a NamespaceSource reading namespaces from the API server.
+func ClientNamespaceSource(client kubernetes.Interface) NamespaceSource {
+	return clientSource{client: client}
+}
+
+type clientSource struct {
+	client kubernetes.Interface
+}
+
+func (s clientSource) Namespace(ctx context.Context, name string) (*core.Namespace, error) {
+	return s.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
+
+// FixtureNamespaceSource returns a NamespaceSource serving the given namespaces, for evaluating
+// requests without a cluster. Unknown namespaces are reported as not found.
+func FixtureNamespaceSource(namespaces ...*core.Namespace) NamespaceSource {
+	src := make(fixtureSource, len(namespaces))
+	for _, ns := range namespaces {
+		src[ns.Name] = ns
+	}
+	return src
+}
+
+type fixtureSource map[string]*core.Namespace
+
+func (s fixtureSource) Namespace(ctx context.Context, name string) (*core.Namespace, error) {
+	if ns, ok := s[name]; ok {
+		return ns, nil
+	}
+	return nil, apierrors.NewNotFound(core.Resource("namespaces"), name)
+}
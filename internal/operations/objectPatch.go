@@ -0,0 +1,134 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ObjectPatch builds a JSON patch against a known object. It keeps a working copy of the object
+// that every operation is applied to, so later calls see the result of earlier ones; two entries
+// added to a missing map produce one map, not two competing adds. Operations appended through the
+// embedded Patch directly are not applied to the working copy.
+type ObjectPatch struct {
+	Patch
+	doc interface{}
+}
+
+// NewObjectPatch returns a builder for patches against obj, which is either the JSON encoding of
+// the object or any value that encodes to it, such as a typed Kubernetes object.
+func NewObjectPatch(obj interface{}) (*ObjectPatch, error) {
+	data, ok := obj.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(obj); err != nil {
+			return nil, fmt.Errorf("could not encode object: %w", err)
+		}
+	}
+
+	p := &ObjectPatch{}
+	if err := json.Unmarshal(data, &p.doc); err != nil {
+		return nil, fmt.Errorf("could not decode object: %w", err)
+	}
+	if _, ok := p.doc.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("object is not a JSON object")
+	}
+	return p, nil
+}
+
+// EnsureMapEntry adds the operations that set key to value in the string map at path, for example
+// the labels at /metadata/labels or /spec/template/metadata/labels. Nothing is added when the
+// entry already has the value, an existing entry is replaced, and a missing or null map, along
+// with any missing parent objects, is created.
+func (p *ObjectPatch) EnsureMapEntry(path, key, value string) error {
+	tokens := PointerTokens(path)
+	parent, depth, err := p.walk(tokens)
+	if err != nil {
+		return err
+	}
+
+	// the map exists, set the single entry
+	if depth == len(tokens) {
+		current, exists := parent[key]
+		switch {
+		case exists && current == value:
+		case exists:
+			p.Replace(Pointer(append(tokens, key)...), value)
+		default:
+			p.Add(Pointer(append(tokens, key)...), value)
+		}
+		parent[key] = value
+		return nil
+	}
+
+	// create the missing part of the path with the entry in place
+	var created interface{} = map[string]string{key: value}
+	var local interface{} = map[string]interface{}{key: value}
+	for i := len(tokens) - 1; i > depth; i-- {
+		created = map[string]interface{}{tokens[i]: created}
+		local = map[string]interface{}{tokens[i]: local}
+	}
+	p.Add(Pointer(tokens[:depth+1]...), created)
+	parent[tokens[depth]] = local
+	return nil
+}
+
+// RemoveMapEntry adds the operation that removes key from the map at path. Nothing is added when
+// the map or the entry does not exist.
+func (p *ObjectPatch) RemoveMapEntry(path, key string) error {
+	tokens := PointerTokens(path)
+	parent, depth, err := p.walk(tokens)
+	if err != nil || depth < len(tokens) {
+		return err
+	}
+
+	if _, exists := parent[key]; exists {
+		p.Remove(Pointer(append(tokens, key)...))
+		delete(parent, key)
+	}
+	return nil
+}
+
+// walk follows the tokens through the working copy and returns the deepest existing object on the
+// path together with the number of tokens it covers. Missing and null members end the walk, any
+// other non-object value is an error.
+func (p *ObjectPatch) walk(tokens []string) (map[string]interface{}, int, error) {
+	current := p.doc.(map[string]interface{})
+	for i, token := range tokens {
+		next, exists := current[token]
+		if !exists || next == nil {
+			return current, i, nil
+		}
+		m, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, 0, fmt.Errorf("%s is not an object", Pointer(tokens[:i+1]...))
+		}
+		current = m
+	}
+	return current, len(tokens), nil
+}
+
+// EnsureMapEntry returns the operations that set key to value in the string map at path of obj.
+// See ObjectPatch.EnsureMapEntry.
+func EnsureMapEntry(obj interface{}, path, key, value string) ([]PatchOperation, error) {
+	p, err := NewObjectPatch(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.EnsureMapEntry(path, key, value); err != nil {
+		return nil, err
+	}
+	return p.Operations(), nil
+}
+
+// RemoveMapEntry returns the operations that remove key from the map at path of obj. See
+// ObjectPatch.RemoveMapEntry.
+func RemoveMapEntry(obj interface{}, path, key string) ([]PatchOperation, error) {
+	p, err := NewObjectPatch(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.RemoveMapEntry(path, key); err != nil {
+		return nil, err
+	}
+	return p.Operations(), nil
+}
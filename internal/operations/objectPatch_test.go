@@ -0,0 +1,95 @@
+package operations
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureMapEntry(t *testing.T) {
+	labels := Pointer("metadata", "labels")
+	templateLabels := Pointer("spec", "template", "metadata", "labels")
+	key := "managed-by/appid"
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		path string
+		want []PatchOperation
+		err  bool
+	}{
+		{"nil map", `{"metadata":{"name":"web"}}`, labels,
+			[]PatchOperation{AddPatchOperation(labels, map[string]string{key: "a"})}, false},
+		{"null map", `{"metadata":{"labels":null}}`, labels,
+			[]PatchOperation{AddPatchOperation(labels, map[string]string{key: "a"})}, false},
+		{"missing entry", `{"metadata":{"labels":{"app":"web"}}}`, labels,
+			[]PatchOperation{AddPatchOperation(Pointer("metadata", "labels", key), "a")}, false},
+		{"stale entry", `{"metadata":{"labels":{"managed-by/appid":"old"}}}`, labels,
+			[]PatchOperation{ReplacePatchOperation(Pointer("metadata", "labels", key), "a")}, false},
+		{"current entry", `{"metadata":{"labels":{"managed-by/appid":"a"}}}`, labels, nil, false},
+		{"missing parents", `{"spec":{}}`, templateLabels,
+			[]PatchOperation{AddPatchOperation(Pointer("spec", "template"), map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]string{key: "a"}},
+			})}, false},
+		{"typed object", &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "web", Labels: map[string]string{"app": "web"}}}, labels,
+			[]PatchOperation{AddPatchOperation(Pointer("metadata", "labels", key), "a")}, false},
+		{"path through a value", `{"metadata":{"labels":"web"}}`, labels, nil, true},
+	}
+
+	for _, tt := range tests {
+		obj := tt.obj
+		if s, ok := obj.(string); ok {
+			obj = []byte(s)
+		}
+		got, err := EnsureMapEntry(obj, tt.path, key, "a")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: EnsureMapEntry() returned incorrect error, got %v, wanted error %v", tt.name, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: EnsureMapEntry() returned incorrect value, got %+v, wanted %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestObjectPatchSeesEarlierOperations(t *testing.T) {
+	p, err := NewObjectPatch([]byte(`{"metadata":{"name":"web"}}`))
+	if err != nil {
+		t.Fatalf("NewObjectPatch() returned an error: %v", err)
+	}
+	labels := Pointer("metadata", "labels")
+	for _, kv := range [][2]string{{"team", "x"}, {"managed-by/appid", "a"}, {"team", "x"}} {
+		if err := p.EnsureMapEntry(labels, kv[0], kv[1]); err != nil {
+			t.Fatalf("EnsureMapEntry() returned an error: %v", err)
+		}
+	}
+	if err := p.RemoveMapEntry(labels, "missing"); err != nil {
+		t.Fatalf("RemoveMapEntry() returned an error: %v", err)
+	}
+
+	want := []PatchOperation{AddPatchOperation(labels, map[string]string{"team": "x", "managed-by/appid": "a"})}
+	if got := p.Operations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Operations() returned incorrect value, got %+v, wanted %+v", got, want)
+	}
+}
+
+func TestRemoveMapEntry(t *testing.T) {
+	labels := Pointer("metadata", "labels")
+
+	got, err := RemoveMapEntry([]byte(`{"metadata":{"labels":{"a/b":"x"}}}`), labels, "a/b")
+	if err != nil {
+		t.Fatalf("RemoveMapEntry() returned an error: %v", err)
+	}
+	if want := []PatchOperation{RemovePatchOperation("/metadata/labels/a~1b")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoveMapEntry() returned incorrect value, got %+v, wanted %+v", got, want)
+	}
+
+	for _, obj := range []string{`{"metadata":{}}`, `{"metadata":{"labels":{}}}`} {
+		got, err := RemoveMapEntry([]byte(obj), labels, "a/b")
+		if err != nil || got != nil {
+			t.Errorf("RemoveMapEntry(%s) returned incorrect value, got %+v, %v, wanted no operations", obj, got, err)
+		}
+	}
+}
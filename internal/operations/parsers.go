@@ -5,8 +5,18 @@ import (
 
 	dep "k8s.io/api/apps/v1"
 	pod "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+func parseObjectMeta(object []byte) (*meta.ObjectMeta, error) {
+	var om meta.PartialObjectMetadata
+	if err := json.Unmarshal(object, &om); err != nil {
+		return nil, err
+	}
+
+	return &om.ObjectMeta, nil
+}
+
 func parseDeployment(object []byte) (*dep.Deployment, error) {
 	var dp dep.Deployment
 	if err := json.Unmarshal(object, &dp); err != nil {
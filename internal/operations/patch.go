@@ -1,19 +1,130 @@
 package operations
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 const (
 	addOperation     = "add"
 	removeOperation  = "remove"
 	replaceOperation = "replace"
 	copyOperation    = "copy"
 	moveOperation    = "move"
+	testOperation    = "test"
 )
 
 // PatchOperation is an operation of a JSON patch https://tools.ietf.org/html/rfc6902.
 type PatchOperation struct {
 	Op    string      `json:"op"`
 	Path  string      `json:"path"`
-	From  string      `json:"from"`
-	Value interface{} `json:"value,omitempty"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON emits only the members defined for the operation: value for add, replace and test,
+// even when it is a falsy value such as an empty string, and from for copy and move.
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	switch op.Op {
+	case addOperation, replaceOperation, testOperation:
+		return json.Marshal(struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value"`
+		}{op.Op, op.Path, op.Value})
+	case removeOperation:
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	case copyOperation, moveOperation:
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			From string `json:"from"`
+			Path string `json:"path"`
+		}{op.Op, op.From, op.Path})
+	default:
+		return nil, fmt.Errorf("unknown JSON patch operation %q", op.Op)
+	}
+}
+
+// Validate checks the operation against RFC 6902: a known op and well formed JSON pointers.
+func (op PatchOperation) Validate() error {
+	switch op.Op {
+	case addOperation, removeOperation, replaceOperation, testOperation:
+	case copyOperation, moveOperation:
+		if err := validatePointer(op.From); err != nil {
+			return fmt.Errorf("%s from %q: %w", op.Op, op.From, err)
+		}
+	default:
+		return fmt.Errorf("unknown JSON patch operation %q", op.Op)
+	}
+	if err := validatePointer(op.Path); err != nil {
+		return fmt.Errorf("%s path %q: %w", op.Op, op.Path, err)
+	}
+	if op.Op == moveOperation && strings.HasPrefix(op.Path+"/", op.From+"/") {
+		return fmt.Errorf("move from %q to %q: a location cannot be moved into one of its children", op.From, op.Path)
+	}
+	return nil
+}
+
+// ValidatePatch validates every operation of the patch.
+func ValidatePatch(ops []PatchOperation) error {
+	var errs []error
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("operation %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatePointer checks the JSON pointer syntax of https://tools.ietf.org/html/rfc6901: empty or
+// starting with "/", with "~" only appearing as the escapes "~0" and "~1".
+func validatePointer(pointer string) error {
+	if pointer == "" {
+		return nil
+	}
+	if pointer[0] != '/' {
+		return errors.New("JSON pointer must start with /")
+	}
+	for i := 0; i < len(pointer); i++ {
+		if pointer[i] == '~' && (i+1 == len(pointer) || (pointer[i+1] != '0' && pointer[i+1] != '1')) {
+			return errors.New("JSON pointer contains an invalid ~ escape")
+		}
+	}
+	return nil
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// Pointer joins unescaped reference tokens into a JSON pointer, escaping "~" and "/" in every
+// token, for example Pointer("metadata", "labels", "managed-by/appid") returns
+// "/metadata/labels/managed-by~1appid".
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(token))
+	}
+	return b.String()
+}
+
+// PointerTokens splits a JSON pointer into its unescaped reference tokens.
+func PointerTokens(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens
 }
 
 // AddPatchOperation returns an add JSON patch operation.
@@ -58,4 +169,13 @@ func MovePatchOperation(from, path string) PatchOperation {
 		Path: path,
 		From: from,
 	}
-}
\ No newline at end of file
+}
+
+// TestPatchOperation returns a test JSON patch operation.
+func TestPatchOperation(path string, value interface{}) PatchOperation {
+	return PatchOperation{
+		Op:    testOperation,
+		Path:  path,
+		Value: value,
+	}
+}
@@ -0,0 +1,190 @@
+package operations
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Patch builds a JSON patch. Operations on the same object member are merged so the patch sent to
+// the API server holds at most one operation per location:
+//
+//   - an add or replace identical to an earlier one is dropped
+//   - add or replace after add or replace keeps the earlier op with the later value
+//   - add after remove becomes a replace, and remove after replace becomes a remove
+//   - add, replace or remove of a member of an earlier added map is folded into that map
+//   - add, replace or remove of a location drops earlier operations on its children
+//
+// Paths into arrays are never merged because indices shift as operations apply, and copy, move
+// and test operations are kept in place and end merging across them.
+type Patch struct {
+	ops []PatchOperation
+	// barrier is the index of the first operation that may still be merged with
+	barrier int
+}
+
+// Add adds an add operation to the patch.
+func (p *Patch) Add(path string, value interface{}) *Patch {
+	return p.Append(AddPatchOperation(path, value))
+}
+
+// Replace adds a replace operation to the patch.
+func (p *Patch) Replace(path string, value interface{}) *Patch {
+	return p.Append(ReplacePatchOperation(path, value))
+}
+
+// Remove adds a remove operation to the patch.
+func (p *Patch) Remove(path string) *Patch {
+	return p.Append(RemovePatchOperation(path))
+}
+
+// Append adds operations to the patch, merging them with earlier operations where possible.
+func (p *Patch) Append(ops ...PatchOperation) *Patch {
+	for _, op := range ops {
+		p.append(op)
+	}
+	return p
+}
+
+// Operations returns the operations of the patch, or nil when it is empty.
+func (p *Patch) Operations() []PatchOperation {
+	if len(p.ops) == 0 {
+		return nil
+	}
+	return append([]PatchOperation(nil), p.ops...)
+}
+
+// Len returns the number of operations in the patch.
+func (p *Patch) Len() int {
+	return len(p.ops)
+}
+
+func (p *Patch) append(op PatchOperation) {
+	if !mergeable(op) {
+		p.ops = append(p.ops, op)
+		p.barrier = len(p.ops)
+		return
+	}
+
+	// drop earlier operations on children of the location, which this operation overwrites
+	kept := p.ops[:p.barrier]
+	for _, earlier := range p.ops[p.barrier:] {
+		if !strings.HasPrefix(earlier.Path, op.Path+"/") {
+			kept = append(kept, earlier)
+		}
+	}
+	p.ops = kept
+
+	for i := len(p.ops) - 1; i >= p.barrier; i-- {
+		earlier := &p.ops[i]
+		switch {
+		case earlier.Path == op.Path:
+			if merged, ok := mergeSamePath(*earlier, op); ok {
+				*earlier = merged
+				return
+			}
+			p.ops = append(p.ops, op)
+			return
+		case strings.HasPrefix(op.Path, earlier.Path+"/"):
+			if merged, ok := foldIntoMap(*earlier, op); ok {
+				*earlier = merged
+				return
+			}
+			p.ops = append(p.ops, op)
+			return
+		}
+	}
+	p.ops = append(p.ops, op)
+}
+
+// mergeable reports whether the operation can be merged with others: add, replace or remove of a
+// location that is not inside an array.
+func mergeable(op PatchOperation) bool {
+	switch op.Op {
+	case addOperation, replaceOperation, removeOperation:
+	default:
+		return false
+	}
+	for _, token := range PointerTokens(op.Path) {
+		if token == "-" {
+			return false
+		}
+		if _, err := strconv.Atoi(token); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeSamePath(earlier, op PatchOperation) (PatchOperation, bool) {
+	// a second remove of the same location fails, so it is not a duplicate
+	if earlier.Op == op.Op && op.Op != removeOperation && reflect.DeepEqual(earlier.Value, op.Value) {
+		return earlier, true
+	}
+
+	switch {
+	case op.Op == removeOperation && earlier.Op == replaceOperation:
+		return op, true
+	case op.Op == removeOperation:
+		// add then remove differs from a single remove when the location did not exist
+		return PatchOperation{}, false
+	case earlier.Op == removeOperation && op.Op == addOperation:
+		return ReplacePatchOperation(op.Path, op.Value), true
+	case earlier.Op == removeOperation:
+		return PatchOperation{}, false
+	default:
+		earlier.Value = op.Value
+		return earlier, true
+	}
+}
+
+// foldIntoMap folds an operation on a direct member of a map added or replaced by earlier into the
+// value of earlier.
+func foldIntoMap(earlier, op PatchOperation) (PatchOperation, bool) {
+	if earlier.Op == removeOperation {
+		return PatchOperation{}, false
+	}
+	rest := strings.TrimPrefix(op.Path, earlier.Path+"/")
+	if strings.Contains(rest, "/") {
+		return PatchOperation{}, false
+	}
+	key := pointerUnescaper.Replace(rest)
+
+	switch m := earlier.Value.(type) {
+	case map[string]string:
+		value, ok := op.Value.(string)
+		if op.Op != removeOperation && !ok {
+			return PatchOperation{}, false
+		}
+		if _, exists := m[key]; op.Op != addOperation && !exists {
+			return PatchOperation{}, false
+		}
+		folded := make(map[string]string, len(m)+1)
+		for k, v := range m {
+			folded[k] = v
+		}
+		if op.Op == removeOperation {
+			delete(folded, key)
+		} else {
+			folded[key] = value
+		}
+		earlier.Value = folded
+		return earlier, true
+	case map[string]interface{}:
+		if _, exists := m[key]; op.Op != addOperation && !exists {
+			return PatchOperation{}, false
+		}
+		folded := make(map[string]interface{}, len(m)+1)
+		for k, v := range m {
+			folded[k] = v
+		}
+		if op.Op == removeOperation {
+			delete(folded, key)
+		} else {
+			folded[key] = op.Value
+		}
+		earlier.Value = folded
+		return earlier, true
+	}
+	return PatchOperation{}, false
+}
@@ -0,0 +1,200 @@
+package operations
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+func TestPatchOperationMarshalJSON(t *testing.T) {
+	tests := []struct {
+		op   PatchOperation
+		want string
+	}{
+		{AddPatchOperation("/a", ""), `{"op":"add","path":"/a","value":""}`},
+		{AddPatchOperation("/a", false), `{"op":"add","path":"/a","value":false}`},
+		{AddPatchOperation("/a", nil), `{"op":"add","path":"/a","value":null}`},
+		{ReplacePatchOperation("/a", 0), `{"op":"replace","path":"/a","value":0}`},
+		{TestPatchOperation("/a", "x"), `{"op":"test","path":"/a","value":"x"}`},
+		{RemovePatchOperation("/a"), `{"op":"remove","path":"/a"}`},
+		{CopyPatchOperation("/a", "/b"), `{"op":"copy","from":"/a","path":"/b"}`},
+		{MovePatchOperation("/a", "/b"), `{"op":"move","from":"/a","path":"/b"}`},
+	}
+
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.op)
+		if err != nil {
+			t.Errorf("Marshal(%+v) returned an error: %v", tt.op, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal() returned incorrect value, got %s, wanted %s", got, tt.want)
+		}
+	}
+
+	// the struct tags alone, used by marshal paths that bypass MarshalJSON, keep a falsy value too
+	type plain PatchOperation
+	if got, _ := json.Marshal(plain(AddPatchOperation("/a", ""))); string(got) != `{"op":"add","path":"/a","value":""}` {
+		t.Errorf("Marshal() returned incorrect value, got %s, wanted %s", got, `{"op":"add","path":"/a","value":""}`)
+	}
+
+	if _, err := json.Marshal(PatchOperation{Op: "merge", Path: "/a"}); err == nil {
+		t.Errorf("Marshal() of an unknown op returned no error")
+	}
+}
+
+// TestPointer checks the escaping examples of RFC 6901 section 5.
+func TestPointer(t *testing.T) {
+	tests := []struct {
+		tokens []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"foo", "0"}, "/foo/0"},
+		{[]string{""}, "/"},
+		{[]string{"a/b"}, "/a~1b"},
+		{[]string{"m~n"}, "/m~0n"},
+		{[]string{"~1"}, "/~01"},
+		{[]string{"metadata", "labels", "managed-by/appid"}, "/metadata/labels/managed-by~1appid"},
+	}
+
+	for _, tt := range tests {
+		got := Pointer(tt.tokens...)
+		if got != tt.want {
+			t.Errorf("Pointer(%q) returned incorrect value, got %q, wanted %q", tt.tokens, got, tt.want)
+		}
+		if back := PointerTokens(got); !reflect.DeepEqual(back, tt.tokens) {
+			t.Errorf("PointerTokens(%q) returned incorrect value, got %q, wanted %q", got, back, tt.tokens)
+		}
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	tests := []struct {
+		op    PatchOperation
+		valid bool
+	}{
+		{AddPatchOperation("/metadata/labels/a~1b", "x"), true},
+		{AddPatchOperation("", "x"), true},
+		{AddPatchOperation("metadata/labels", "x"), false},
+		{AddPatchOperation("/metadata/labels/a~2b", "x"), false},
+		{AddPatchOperation("/metadata/labels/a~", "x"), false},
+		{CopyPatchOperation("a", "/b"), false},
+		{MovePatchOperation("/a", "/a/b"), false},
+		{MovePatchOperation("/a", "/ab"), true},
+		{PatchOperation{Op: "merge", Path: "/a"}, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePatch([]PatchOperation{tt.op})
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidatePatch(%+v) returned incorrect value, got %v, wanted valid %v", tt.op, err, tt.valid)
+		}
+	}
+}
+
+// TestRFC6902Examples applies the examples of RFC 6902 appendix A built from PatchOperations.
+func TestRFC6902Examples(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ops  []PatchOperation
+		want string
+	}{
+		{"A.1 adding an object member", `{"foo":"bar"}`,
+			[]PatchOperation{AddPatchOperation("/baz", "qux")}, `{"baz":"qux","foo":"bar"}`},
+		{"A.2 adding an array element", `{"foo":["bar","baz"]}`,
+			[]PatchOperation{AddPatchOperation("/foo/1", "qux")}, `{"foo":["bar","qux","baz"]}`},
+		{"A.3 removing an object member", `{"baz":"qux","foo":"bar"}`,
+			[]PatchOperation{RemovePatchOperation("/baz")}, `{"foo":"bar"}`},
+		{"A.4 removing an array element", `{"foo":["bar","qux","baz"]}`,
+			[]PatchOperation{RemovePatchOperation("/foo/1")}, `{"foo":["bar","baz"]}`},
+		{"A.5 replacing a value", `{"baz":"qux","foo":"bar"}`,
+			[]PatchOperation{ReplacePatchOperation("/baz", "boo")}, `{"baz":"boo","foo":"bar"}`},
+		{"A.6 moving a value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			[]PatchOperation{MovePatchOperation("/foo/waldo", "/qux/thud")}, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"A.7 moving an array element", `{"foo":["all","grass","cows","eat"]}`,
+			[]PatchOperation{MovePatchOperation("/foo/1", "/foo/3")}, `{"foo":["all","cows","eat","grass"]}`},
+		{"A.8 testing a value", `{"baz":"qux","foo":["a",2,"c"]}`,
+			[]PatchOperation{TestPatchOperation("/baz", "qux"), TestPatchOperation("/foo/1", 2)}, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"A.10 adding a nested member object", `{"foo":"bar"}`,
+			[]PatchOperation{AddPatchOperation("/child", map[string]interface{}{"grandchild": map[string]interface{}{}})}, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{"A.14 escape ordering", `{"/":9,"~1":10}`,
+			[]PatchOperation{TestPatchOperation(Pointer("~1"), 10)}, `{"/":9,"~1":10}`},
+		{"A.16 adding an array value", `{"foo":["bar"]}`,
+			[]PatchOperation{AddPatchOperation("/foo/-", []string{"abc", "def"})}, `{"foo":["bar",["abc","def"]]}`},
+		{"empty string value", `{"labels":{}}`,
+			[]PatchOperation{AddPatchOperation(Pointer("labels", "a/b"), "")}, `{"labels":{"a/b":""}}`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.ops)
+		if err != nil {
+			t.Fatalf("%s: Marshal() returned an error: %v", tt.name, err)
+		}
+		patch, err := jsonpatch.DecodePatch(data)
+		if err != nil {
+			t.Fatalf("%s: DecodePatch() returned an error: %v", tt.name, err)
+		}
+		got, err := patch.Apply([]byte(tt.doc))
+		if err != nil {
+			t.Errorf("%s: Apply() returned an error: %v", tt.name, err)
+			continue
+		}
+		if !jsonpatch.Equal(got, []byte(tt.want)) {
+			t.Errorf("%s: Apply() returned incorrect value, got %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatchBuilder(t *testing.T) {
+	labels := Pointer("metadata", "labels")
+	appid := Pointer("metadata", "labels", "managed-by/appid")
+
+	tests := []struct {
+		name  string
+		build func(p *Patch)
+		want  []PatchOperation
+	}{
+		{"duplicates are dropped", func(p *Patch) {
+			p.Add(appid, "a").Add(appid, "a")
+		}, []PatchOperation{AddPatchOperation(appid, "a")}},
+		{"repeated removes are kept", func(p *Patch) {
+			p.Remove(appid).Remove(appid)
+		}, []PatchOperation{RemovePatchOperation(appid), RemovePatchOperation(appid)}},
+		{"later value wins", func(p *Patch) {
+			p.Add(appid, "a").Replace(appid, "b")
+		}, []PatchOperation{AddPatchOperation(appid, "b")}},
+		{"remove then add becomes replace", func(p *Patch) {
+			p.Remove(appid).Add(appid, "b")
+		}, []PatchOperation{ReplacePatchOperation(appid, "b")}},
+		{"replace then remove becomes remove", func(p *Patch) {
+			p.Replace(appid, "a").Remove(appid)
+		}, []PatchOperation{RemovePatchOperation(appid)}},
+		{"add then remove is kept", func(p *Patch) {
+			p.Add(appid, "a").Remove(appid)
+		}, []PatchOperation{AddPatchOperation(appid, "a"), RemovePatchOperation(appid)}},
+		{"members fold into an added map", func(p *Patch) {
+			p.Add(labels, map[string]string{"team": "x"}).Add(appid, "a").Remove(Pointer("metadata", "labels", "team"))
+		}, []PatchOperation{AddPatchOperation(labels, map[string]string{"managed-by/appid": "a"})}},
+		{"parent overwrites children", func(p *Patch) {
+			p.Add(appid, "a").Add(labels, map[string]string{"team": "x"})
+		}, []PatchOperation{AddPatchOperation(labels, map[string]string{"team": "x"})}},
+		{"array paths are not merged", func(p *Patch) {
+			p.Add("/spec/containers/0/env/-", 1).Add("/spec/containers/0/env/-", 1)
+		}, []PatchOperation{AddPatchOperation("/spec/containers/0/env/-", 1), AddPatchOperation("/spec/containers/0/env/-", 1)}},
+		{"test ends merging", func(p *Patch) {
+			p.Add(appid, "a").Append(TestPatchOperation(appid, "a")).Add(appid, "b")
+		}, []PatchOperation{AddPatchOperation(appid, "a"), TestPatchOperation(appid, "a"), AddPatchOperation(appid, "b")}},
+	}
+
+	for _, tt := range tests {
+		var p Patch
+		tt.build(&p)
+		if got := p.Operations(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Operations() returned incorrect value, got %+v, wanted %+v", tt.name, got, tt.want)
+		}
+	}
+}
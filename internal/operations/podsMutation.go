@@ -3,184 +3,108 @@ package operations
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
 
 	admission "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
 
 	"mutating-webhook/internal/config"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"mutating-webhook/internal/logging"
 )
 
 func PodsMutation() Hook {
 	return Hook{
+		Name:   "pod-mutation",
 		Create: podAppIDMutation(),
 		Update: podAppIDMutation(),
 		// default allow
-		Delete: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Delete: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Connect: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Connect: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
 	}
 }
 
 func podAppIDMutation() AdmitFunc {
-	return func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
-		// Skip if labeling is disabled
-		if !cfg.EnableLabeling {
-			log.Printf("[DEBUG] Custom labeling is disabled")
-			return &Result{Allowed: true}, nil
-		}
-
-		// Skip if namespace is excluded
-		if isNamespaceExcluded(r.Namespace, cfg.ExcludedNamespaces) {
-			log.Printf("[DEBUG] Namespace %s is excluded from labeling", r.Namespace)
-			return &Result{Allowed: true}, nil
-		}
+	return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		logger := logging.FromContext(ctx)
 
 		pod, err := parsePod(r.Object.Raw)
 		if err != nil {
 			return &Result{Msg: err.Error()}, nil
 		}
 
-		// Check if this is a dry run
-		if cfg.DryRun {
-			log.Printf("[INFO] DRY RUN: Would apply appid label to pod %s/%s", r.Namespace, pod.Name)
-			return &Result{Allowed: true}, nil
-		}
-
 		// Get appid from the namespace
-		appid := getAppIDFromNamespace(r.Namespace)
+		appid, source, err := getAppIDFromNamespace(ctx, r.Namespace)
+		if err != nil {
+			return nil, err
+		}
 		if appid == "" {
-			log.Printf("[DEBUG] No appid found in namespace %s, skipping", r.Namespace)
-			return &Result{Allowed: true}, nil
+			logger.Debug("No appid found in namespace, skipping")
+			return &Result{Allowed: true, Reason: ReasonMissingAppID}, nil
 		}
 
 		// Apply only the appid label
-		appidLabelKey := fmt.Sprintf("%s/appid", cfg.LabelPrefix)
-		var operations []PatchOperation
-
-		// Check if appid label already exists with the same value
-		if pod.Labels != nil {
-			if existingAppID, exists := pod.Labels[appidLabelKey]; exists && existingAppID == appid {
-				log.Printf("[DEBUG] AppID label already exists with correct value for pod %s/%s", r.Namespace, pod.Name)
-				return &Result{Allowed: true}, nil
-			}
+		operations, err := AppIDLabelPatch(r.Object.Raw, cfg.AppIDLabel(), appid)
+		if err != nil {
+			return nil, err
 		}
-
-		// Add the appid label
-		if pod.Labels == nil {
-			// If no labels exist, create the labels map with only appid
-			labels := map[string]string{appidLabelKey: appid}
-			operations = append(operations, AddPatchOperation("/metadata/labels", labels))
-		} else {
-			// Add individual appid label
-			path := fmt.Sprintf("/metadata/labels/%s", strings.ReplaceAll(appidLabelKey, "/", "~1"))
-			operations = append(operations, AddPatchOperation(path, appid))
+		if len(operations) == 0 {
+			logger.Debug("AppID label already exists with correct value", "appid", appid)
+			return &Result{Allowed: true, AppID: appid, AppIDSource: source}, nil
 		}
 
-		log.Printf("[INFO] Applied appid label '%s' to pod %s/%s", appid, r.Namespace, pod.Name)
+		logger.Info("Applied appid label", "appid", appid, "pod", pod.Name)
 
 		return &Result{
-			Allowed:  true,
-			PatchOps: operations,
+			Allowed:     true,
+			AppID:       appid,
+			AppIDSource: source,
+			PatchOps:    operations,
 		}, nil
 	}
 }
 
-func isNamespaceExcluded(namespace string, excludedNamespaces []string) bool {
-	// Always exclude system namespaces
-	systemNamespaces := []string{
-		"kube-system",
-		"kube-public",
-		"kube-node-lease",
-		"openshift-system",
-		"openshift-kube-apiserver",
-		"openshift-kube-scheduler",
-		"openshift-kube-controller-manager",
-		"openshift-etcd",
-		"openshift-apiserver",
-		"openshift-controller-manager",
-		"openshift-authentication",
-		"openshift-oauth-apiserver",
-		"openshift-service-ca",
-		"openshift-network-operator",
-		"openshift-cluster-machine-approver",
-		"openshift-cluster-samples-operator",
-		"openshift-cluster-storage-operator",
-		"openshift-cluster-version",
-		"openshift-config",
-		"openshift-config-managed",
-		"openshift-console",
-		"openshift-console-operator",
-		"openshift-dns",
-		"openshift-dns-operator",
-		"openshift-image-registry",
-		"openshift-ingress",
-		"openshift-ingress-operator",
-		"openshift-machine-api",
-		"openshift-machine-config-operator",
-		"openshift-monitoring",
-		"openshift-multus",
-		"openshift-node",
-		"openshift-operator-lifecycle-manager",
-		"openshift-operators",
-		"openshift-ovn-kubernetes",
-		"openshift-sdn",
-		"openshift-user-workload-monitoring",
-		"openshift-webhook", // Our own namespace
-	}
-
-	allExcluded := append(systemNamespaces, excludedNamespaces...)
-	for _, excluded := range allExcluded {
-		if namespace == excluded {
-			return true
-		}
-	}
-	return false
-}
-
-func getAppIDFromNamespace(namespace string) string {
-	// Create in-cluster client
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Printf("[ERROR] Failed to create in-cluster config: %v", err)
-		return ""
-	}
+// Sources an appid can be resolved from, reported in audit records.
+const (
+	appIDSourceAnnotation = "namespace-annotation"
+	appIDSourceLabel      = "namespace-label"
+)
 
-	clientset, err := kubernetes.NewForConfig(config)
+// getAppIDFromNamespace looks up the appid annotation or label on the namespace and reports where
+// it was found. The lookup is bound to ctx so a slow API server cannot hold the admission request
+// past its deadline.
+func getAppIDFromNamespace(ctx context.Context, namespace string) (string, string, error) {
+	ns, err := lookupNamespace(ctx, namespace)
 	if err != nil {
-		log.Printf("[ERROR] Failed to create clientset: %v", err)
-		return ""
+		return "", "", fmt.Errorf("failed to get namespace %s: %w", namespace, err)
 	}
 
-	// Get the namespace object
-	ns, err := clientset.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
-	if err != nil {
-		log.Printf("[ERROR] Failed to get namespace %s: %v", namespace, err)
-		return ""
+	appid, source := ResolveAppID(ns)
+	if appid == "" {
+		logging.FromContext(ctx).Debug("No appid found in namespace")
+		return "", "", nil
 	}
+	logging.FromContext(ctx).Debug("Found appid in namespace", "appid", appid, "source", source)
+	return appid, source, nil
+}
 
-	// Check for appid in annotations
-	if ns.Annotations != nil {
-		if appid, exists := ns.Annotations["appid"]; exists {
-			log.Printf("[DEBUG] Found appid '%s' in namespace '%s'", appid, namespace)
-			return appid
-		}
+// ResolveAppID returns the appid of the namespace and where it was found. The appid annotation
+// takes precedence over the appid label.
+func ResolveAppID(ns *core.Namespace) (string, string) {
+	if appid, exists := ns.Annotations["appid"]; exists {
+		return appid, appIDSourceAnnotation
 	}
-
-	// Check for appid in labels as fallback
-	if ns.Labels != nil {
-		if appid, exists := ns.Labels["appid"]; exists {
-			log.Printf("[DEBUG] Found appid '%s' in namespace labels '%s'", appid, namespace)
-			return appid
-		}
+	if appid, exists := ns.Labels["appid"]; exists {
+		return appid, appIDSourceLabel
 	}
+	return "", ""
+}
 
-	log.Printf("[DEBUG] No appid found in namespace '%s'", namespace)
-	return ""
+// AppIDLabelPatch returns the operations that set the appid label on obj, or nil when the label
+// already has the correct value. Only the labels of the object itself are changed, never those of a
+// pod template, so patching a workload does not trigger a rollout.
+func AppIDLabelPatch(obj interface{}, key, appid string) ([]PatchOperation, error) {
+	return EnsureMapEntry(obj, Pointer("metadata", "labels"), key, appid)
 }
@@ -1,34 +1,36 @@
 package operations
 
 import (
-	"log"
+	"context"
 	"strings"
 
 	admission "k8s.io/api/admission/v1"
 
 	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/logging"
 )
 
 func PodsValidation() Hook {
 	return Hook{
+		Name: "pod-validation",
 		// default allow
-		Create: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Create: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Delete: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Delete: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Update: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Update: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
-		Connect: func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+		Connect: func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 			return &Result{Allowed: true}, nil
 		},
 	}
 }
 
 func podValidationCreate() AdmitFunc {
-	return func(r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
+	return func(ctx context.Context, r *admission.AdmissionRequest, cfg *config.Config) (*Result, error) {
 		pod, err := parsePod(r.Object.Raw)
 		if err != nil {
 			return &Result{Msg: err.Error()}, nil
@@ -37,7 +39,7 @@ func podValidationCreate() AdmitFunc {
 		for _, c := range pod.Spec.Containers {
 			if strings.HasSuffix(c.Image, ":latest") {
 				msg := "You cannot use the tag 'latest' in a container."
-				log.Printf("[TRACE] Request Rejectd: %s", msg)
+				logging.Trace(ctx, "Request rejected", "reason", msg)
 				return &Result{Msg: msg}, nil
 			}
 		}
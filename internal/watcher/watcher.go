@@ -0,0 +1,210 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"mutating-webhook/internal/backfill"
+	"mutating-webhook/internal/config"
+	"mutating-webhook/internal/events"
+	"mutating-webhook/internal/metrics"
+	"mutating-webhook/internal/operations"
+)
+
+// resync is how often namespaces are revisited, which clears the drift metric of namespaces whose
+// objects were relabeled or recreated in the meantime.
+const resync = 10 * time.Minute
+
+// Reasons of the events emitted by the watcher.
+const (
+	ReasonAppIDChanged = "AppIDChanged"
+	ReasonRelabeled    = "AppIDRelabeled"
+)
+
+// change is a pending appid change of a namespace.
+type change struct {
+	from, to string
+}
+
+// Watcher watches namespaces for appid changes and applies the AppIDChangePolicy to the pods and
+// workloads in the namespace: relabel patches them with the new appid, flag only reports them as
+// drifted through the webhook_appid_drift_objects metric and an event.
+type Watcher struct {
+	client   kubernetes.Interface
+	cfg      *config.Store
+	recorder events.Recorder
+	queue    workqueue.RateLimitingInterface
+
+	mu      sync.Mutex
+	changes map[string]change
+	drifted map[string]bool
+}
+
+// New returns a Watcher for the namespaces visible to client.
+func New(client kubernetes.Interface, cfg *config.Store, recorder events.Recorder) *Watcher {
+	return &Watcher{
+		client:   client,
+		cfg:      cfg,
+		recorder: recorder,
+		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		changes:  make(map[string]change),
+		drifted:  make(map[string]bool),
+	}
+}
+
+// Run watches namespaces until ctx is cancelled. It should only run on the elected replica, so
+// objects are not relabeled and events are not emitted once per replica.
+func (w *Watcher) Run(ctx context.Context) {
+	factory := informers.NewSharedInformerFactory(w.client, resync)
+	informer := factory.Core().V1().Namespaces()
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: w.update,
+	})
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return
+	}
+	slog.Info("Watching namespaces for appid changes", "policy", w.cfg.Load().AppIDChangePolicy)
+
+	go func() {
+		<-ctx.Done()
+		w.queue.ShutDown()
+	}()
+	for w.next(ctx, informer.Lister()) {
+	}
+}
+
+// update queues namespaces whose appid changed, and namespaces flagged as drifted so their drift
+// is recounted on every resync.
+func (w *Watcher) update(oldObj, newObj interface{}) {
+	oldNS, ok := oldObj.(*core.Namespace)
+	if !ok {
+		return
+	}
+	newNS, ok := newObj.(*core.Namespace)
+	if !ok {
+		return
+	}
+
+	from, _ := operations.ResolveAppID(oldNS)
+	to, _ := operations.ResolveAppID(newNS)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case from != to:
+		// Keep the original appid when the namespace changes again before it is processed
+		if pending, ok := w.changes[newNS.Name]; ok {
+			from = pending.from
+		}
+		w.changes[newNS.Name] = change{from: from, to: to}
+	case !w.drifted[newNS.Name]:
+		return
+	}
+	w.queue.Add(newNS.Name)
+}
+
+func (w *Watcher) next(ctx context.Context, lister corelisters.NamespaceLister) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+
+	name := item.(string)
+	if err := w.reconcile(ctx, lister, name); err != nil {
+		slog.Error("Failed to reconcile namespace appid", "namespace", name, "error", err)
+		w.queue.AddRateLimited(item)
+		return true
+	}
+	w.queue.Forget(item)
+	return true
+}
+
+func (w *Watcher) reconcile(ctx context.Context, lister corelisters.NamespaceLister, name string) error {
+	w.mu.Lock()
+	pending, changed := w.changes[name]
+	delete(w.changes, name)
+	w.mu.Unlock()
+
+	ns, err := lister.Get(name)
+	if errors.IsNotFound(err) {
+		w.setDrift(name, 0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg := w.cfg.Load()
+	appid, _ := operations.ResolveAppID(ns)
+	if cfg.IsNamespaceExcluded(name) || appid == "" {
+		w.setDrift(name, 0)
+		return nil
+	}
+
+	opts := backfill.OptionsFromConfig(cfg)
+	opts.Selector = ""
+	relabel := changed && cfg.AppIDChangePolicy == config.AppIDChangeRelabel
+	if !relabel {
+		opts.DryRun = true
+	}
+
+	report, err := backfill.Namespace(ctx, w.client, cfg, ns, opts)
+	if err != nil {
+		// Requeue with the change so the policy is applied on the next attempt
+		if changed {
+			w.mu.Lock()
+			if _, ok := w.changes[name]; !ok {
+				w.changes[name] = pending
+			}
+			w.mu.Unlock()
+		}
+		return err
+	}
+	drifted := report.Drifted()
+	w.setDrift(name, drifted)
+
+	if !changed {
+		return nil
+	}
+	slog.Info("Namespace appid changed", "namespace", name, "from", pending.from, "to", pending.to,
+		"policy", cfg.AppIDChangePolicy, "drifted", drifted)
+
+	switch {
+	case relabel && !opts.DryRun:
+		w.recorder.Namespace(name, core.EventTypeNormal, ReasonRelabeled,
+			fmt.Sprintf("appid changed from %q to %q; relabeled existing objects, %d could not be relabeled", pending.from, pending.to, drifted))
+	case drifted > 0:
+		total := report.Total()
+		w.recorder.Namespace(name, core.EventTypeWarning, ReasonAppIDChanged,
+			fmt.Sprintf("appid changed from %q to %q; until they are recreated %d existing objects are still labeled with a different appid and %d have no appid label",
+				pending.from, pending.to, total.Stale, total.Missing))
+	}
+	return nil
+}
+
+// setDrift records the drift of a namespace and whether it needs to be recounted on resync.
+func (w *Watcher) setDrift(namespace string, count int) {
+	w.mu.Lock()
+	if count > 0 {
+		w.drifted[namespace] = true
+	} else {
+		delete(w.drifted, namespace)
+	}
+	w.mu.Unlock()
+	metrics.SetAppIDDrift(namespace, count)
+}
@@ -0,0 +1,99 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"mutating-webhook/internal/config"
+)
+
+type event struct {
+	namespace, eventType, reason, message string
+}
+
+type fakeRecorder struct {
+	events []event
+}
+
+func (f *fakeRecorder) Namespace(namespace, eventType, reason, message string) {
+	f.events = append(f.events, event{namespace, eventType, reason, message})
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantLabel string
+		wantEvent string
+		wantCount string
+		wantDrift bool
+	}{
+		{config.AppIDChangeFlag, "old", ReasonAppIDChanged, "1 existing objects are still labeled with a different appid and 1 have no appid label", true},
+		{config.AppIDChangeRelabel, "new", ReasonRelabeled, "0 could not be relabeled", false},
+	}
+
+	for _, tt := range tests {
+		oldNS := &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Annotations: map[string]string{"appid": "old"}}}
+		newNS := &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Annotations: map[string]string{"appid": "new"}}}
+		pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "team-a", Labels: map[string]string{"managed-by/appid": "old"}}}
+
+		unlabeled := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "batch", Namespace: "team-a"}}
+
+		client := fake.NewSimpleClientset(newNS, pod, unlabeled)
+		cfg := config.Config{LabelPrefix: "managed-by", AppIDChangePolicy: tt.policy, BackfillQPS: 100, BackfillBurst: 100}
+		cfg.CompileExclusions()
+		recorder := &fakeRecorder{}
+		w := New(client, config.NewStore(&cfg, nil), recorder)
+
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		_ = indexer.Add(newNS)
+
+		w.update(oldNS, newNS)
+		if w.queue.Len() != 1 {
+			t.Fatalf("update() queued %d namespaces, wanted 1", w.queue.Len())
+		}
+		if err := w.reconcile(context.Background(), corelisters.NewNamespaceLister(indexer), "team-a"); err != nil {
+			t.Fatalf("reconcile() returned an error: %v", err)
+		}
+
+		got, err := client.CoreV1().Pods("team-a").Get(context.Background(), "web", meta.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get() returned an error: %v", err)
+		}
+		if got.Labels["managed-by/appid"] != tt.wantLabel {
+			t.Errorf("policy %s left incorrect appid label, got %q, wanted %q", tt.policy, got.Labels["managed-by/appid"], tt.wantLabel)
+		}
+		if len(recorder.events) != 1 || recorder.events[0].reason != tt.wantEvent {
+			t.Errorf("policy %s emitted incorrect events, got %v, wanted %s", tt.policy, recorder.events, tt.wantEvent)
+		} else if !strings.Contains(recorder.events[0].message, tt.wantCount) {
+			t.Errorf("policy %s emitted incorrect event message, got %q, wanted it to contain %q", tt.policy, recorder.events[0].message, tt.wantCount)
+		}
+		if w.drifted["team-a"] != tt.wantDrift {
+			t.Errorf("policy %s recorded incorrect drift, got %v, wanted %v", tt.policy, w.drifted["team-a"], tt.wantDrift)
+		}
+	}
+}
+
+func TestUpdateIgnoresUnchangedAppID(t *testing.T) {
+	w := New(fake.NewSimpleClientset(), config.NewStore(&config.Config{}, nil), &fakeRecorder{})
+	ns := &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a", Labels: map[string]string{"appid": "same"}}}
+	updated := ns.DeepCopy()
+	updated.Labels["team"] = "payments"
+
+	w.update(ns, updated)
+	if w.queue.Len() != 0 {
+		t.Errorf("update() queued %d namespaces, wanted 0", w.queue.Len())
+	}
+
+	w.drifted["team-a"] = true
+	w.update(ns, updated)
+	if w.queue.Len() != 1 {
+		t.Errorf("update() queued %d drifted namespaces, wanted 1", w.queue.Len())
+	}
+}